@@ -1,11 +1,16 @@
 package actions
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Logger is a very basic Github actions compatible logger.
@@ -18,14 +23,85 @@ func NewLogger() *Logger {
 	return &Logger{Output: os.Stdout}
 }
 
+// AnnotationProperties attach an error, warning, or notice to a location in a file. Empty or zero
+// fields are left out.
+type AnnotationProperties struct {
+	Title     string
+	File      string
+	Line      int
+	Col       int
+	EndLine   int
+	EndColumn int
+}
+
+// commandProperty is a key=value property of a workflow command.
+type commandProperty struct {
+	name  string
+	value string
+}
+
+func (p AnnotationProperties) list() (properties []commandProperty) {
+	add := func(name, value string) {
+		if value != "" {
+			properties = append(properties, commandProperty{name: name, value: value})
+		}
+	}
+
+	addInt := func(name string, value int) {
+		if value > 0 {
+			add(name, strconv.Itoa(value))
+		}
+	}
+
+	add("title", p.Title)
+	add("file", p.File)
+	addInt("line", p.Line)
+	addInt("col", p.Col)
+	addInt("endLine", p.EndLine)
+	addInt("endColumn", p.EndColumn)
+
+	return
+}
+
+var (
+	dataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	propertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// escapeData escapes the message of a workflow command so that newlines and percent signs survive.
+func escapeData(data string) string {
+	return dataEscaper.Replace(data)
+}
+
+// escapeProperty escapes a property value of a workflow command, which additionally cannot contain
+// the characters separating properties from each other and from the message.
+func escapeProperty(value string) string {
+	return propertyEscaper.Replace(value)
+}
+
+// command writes a workflow command with optional properties. The message and property values are
+// escaped.
+func (l *Logger) command(name string, properties []commandProperty, message string) {
+	if len(properties) > 0 {
+		escaped := make([]string, len(properties))
+		for i, property := range properties {
+			escaped[i] = property.name + "=" + escapeProperty(property.value)
+		}
+
+		name += " " + strings.Join(escaped, ",")
+	}
+
+	fmt.Fprintln(l.Output, "::"+name+"::"+escapeData(message))
+}
+
 // Debug writes out a debug log message.
 func (l *Logger) Debug(message string) {
-	fmt.Fprintln(l.Output, "::debug::"+message)
+	l.command("debug", nil, message)
 }
 
 // Debugf writes out a formatted debug log message.
 func (l *Logger) Debugf(format string, values ...any) {
-	fmt.Fprintf(l.Output, "::debug::"+format+"\n", values...)
+	l.Debug(fmt.Sprintf(format, values...))
 }
 
 // Info writes out an info log message.
@@ -38,41 +114,119 @@ func (l *Logger) Infof(format string, values ...any) {
 	fmt.Fprintf(l.Output, format+"\n", values...)
 }
 
+// Notice writes out a notice log message.
+func (l *Logger) Notice(message string) {
+	l.command("notice", nil, message)
+}
+
+// Noticef writes out a formatted notice log message.
+func (l *Logger) Noticef(format string, values ...any) {
+	l.Notice(fmt.Sprintf(format, values...))
+}
+
+// NoticeAnnotation writes out a notice log message attached to a location in a file.
+func (l *Logger) NoticeAnnotation(message string, properties AnnotationProperties) {
+	l.command("notice", properties.list(), message)
+}
+
 // Warn writes out a warning log message.
 func (l *Logger) Warn(message string) {
-	fmt.Fprintln(l.Output, "::warning::"+message)
+	l.command("warning", nil, message)
 }
 
 // Warnf writes out a formatted warning log message.
 func (l *Logger) Warnf(format string, values ...any) {
-	fmt.Fprintf(l.Output, "::warning::"+format+"\n", values...)
+	l.Warn(fmt.Sprintf(format, values...))
+}
+
+// WarnAnnotation writes out a warning log message attached to a location in a file.
+func (l *Logger) WarnAnnotation(message string, properties AnnotationProperties) {
+	l.command("warning", properties.list(), message)
 }
 
 // Error writes out an error log message.
 func (l *Logger) Error(message string) {
-	fmt.Fprintln(l.Output, "::error::"+message)
+	l.command("error", nil, message)
 }
 
 // Errorf writes out a formatted error log message.
 func (l *Logger) Errorf(format string, values ...any) {
-	fmt.Fprintf(l.Output, "::error::"+format+"\n", values...)
+	l.Error(fmt.Sprintf(format, values...))
+}
+
+// ErrorAnnotation writes out an error log message attached to a location in a file.
+func (l *Logger) ErrorAnnotation(message string, properties AnnotationProperties) {
+	l.command("error", properties.list(), message)
+}
+
+// Group starts a collapsible group of log lines with the given name.
+func (l *Logger) Group(name string) {
+	l.command("group", nil, name)
+}
+
+// EndGroup ends the current group of log lines.
+func (l *Logger) EndGroup() {
+	l.command("endgroup", nil, "")
+}
+
+// StopCommands stops the processing of workflow commands until ResumeCommands is called with the
+// returned token. This allows untrusted output to be logged without it being interpreted.
+func (l *Logger) StopCommands() (token string) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+
+	token = hex.EncodeToString(random)
+	l.command("stop-commands", nil, token)
+	return
+}
+
+// ResumeCommands resumes the processing of workflow commands that were stopped with StopCommands.
+func (l *Logger) ResumeCommands(token string) {
+	l.command(token, nil, "")
+}
+
+// Echo enables or disables echoing of workflow commands to the log.
+func (l *Logger) Echo(enabled bool) {
+	if enabled {
+		l.command("echo", nil, "on")
+	} else {
+		l.command("echo", nil, "off")
+	}
 }
 
-// SetSecret tells the actions environment to mask the supplied value.
+// SetSecret tells the actions environment to mask the supplied value. Every line of a multiline
+// value is masked individually, since the runner masks the log line by line.
 func (l *Logger) SetSecret(value string) {
-	fmt.Fprintln(l.Output, "::add-mask::"+value)
+	for _, line := range strings.Split(strings.ReplaceAll(value, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			l.command("add-mask", nil, line)
+		}
+	}
 }
 
 // GetInputOptions defines some options about how the input should be retrieved.
 type GetInputOptions struct {
 	Required       bool
 	TrimWhitespace bool
+
+	// Default is used when the input is not given.
+	Default string
+}
+
+// inputVariable returns the name of the environment variable that holds the named input.
+func inputVariable(name string) string {
+	return "INPUT_" + strings.ToUpper(regexp.MustCompile(`\s`).ReplaceAllString(name, "_"))
 }
 
 // GetInput attempts to get the input given the supplied name.
 func GetInput(name string, options GetInputOptions) (value string, err error) {
-	key := "INPUT_" + strings.ToUpper(regexp.MustCompile(`\s`).ReplaceAllString(name, "_"))
-	value = os.Getenv(key)
+	value = os.Getenv(inputVariable(name))
+
+	if value == "" {
+		value = options.Default
+	}
 
 	if options.Required && value == "" {
 		err = fmt.Errorf("input %s is required but was not given", name)
@@ -89,7 +243,7 @@ func GetInput(name string, options GetInputOptions) (value string, err error) {
 // GetMultilineInput gets a multiline input given the supplied name.
 func GetMultilineInput(name string, options GetInputOptions) (lines []string, err error) {
 	var value string
-	value, err = GetInput(name, GetInputOptions{Required: options.Required})
+	value, err = GetInput(name, GetInputOptions{Required: options.Required, Default: options.Default})
 	if err != nil {
 		return
 	}
@@ -104,3 +258,98 @@ func GetMultilineInput(name string, options GetInputOptions) (lines []string, er
 
 	return
 }
+
+// getTrimmedInput gets an input without surrounding whitespace, which is never meaningful for typed
+// inputs.
+func getTrimmedInput(name string, options GetInputOptions) (string, error) {
+	options.TrimWhitespace = true
+	return GetInput(name, options)
+}
+
+// booleanValues are the true and false values of the YAML 1.2 core schema.
+var booleanValues = map[string]bool{
+	"true": true, "True": true, "TRUE": true,
+	"false": false, "False": false, "FALSE": false,
+}
+
+// GetBooleanInput gets an input that must be one of the YAML 1.2 core schema booleans. An optional
+// input that is not given is false.
+func GetBooleanInput(name string, options GetInputOptions) (value bool, err error) {
+	var raw string
+	raw, err = getTrimmedInput(name, options)
+	if err != nil || raw == "" {
+		return
+	}
+
+	value, ok := booleanValues[raw]
+	if !ok {
+		err = fmt.Errorf(
+			"input %s must be one of: true, True, TRUE, false, False, FALSE (got %q)", name, raw,
+		)
+	}
+
+	return
+}
+
+// GetIntegerInput gets an input that must be an integer between min and max, inclusive. An optional
+// input that is not given is zero, which is an error if zero is out of range. Give such inputs a default.
+func GetIntegerInput(name string, min, max int, options GetInputOptions) (value int, err error) {
+	var raw string
+	raw, err = getTrimmedInput(name, options)
+	if err != nil {
+		return
+	}
+
+	if raw != "" {
+		value, err = strconv.Atoi(raw)
+	}
+
+	if err != nil || value < min || value > max {
+		value = 0
+
+		if max == math.MaxInt {
+			err = fmt.Errorf("input %s must be an integer of at least %d (got %q)", name, min, raw)
+		} else {
+			err = fmt.Errorf("input %s must be an integer from %d to %d (got %q)", name, min, max, raw)
+		}
+	}
+
+	return
+}
+
+// GetDurationInput gets an input that must be a non-negative duration such as 30s or 5m. An optional
+// input that is not given is zero.
+func GetDurationInput(name string, options GetInputOptions) (value time.Duration, err error) {
+	var raw string
+	raw, err = getTrimmedInput(name, options)
+	if err != nil || raw == "" {
+		return
+	}
+
+	value, err = time.ParseDuration(raw)
+	if err != nil || value < 0 {
+		value = 0
+		err = fmt.Errorf("input %s must be a non-negative duration such as 500ms, 30s, or 5m (got %q)", name, raw)
+	}
+
+	return
+}
+
+// GetEnumInput gets an input that must be one of the allowed values. An optional input that is not
+// given is empty.
+func GetEnumInput(name string, allowed []string, options GetInputOptions) (value string, err error) {
+	value, err = getTrimmedInput(name, options)
+	if err != nil || value == "" {
+		return
+	}
+
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+
+	err = fmt.Errorf("input %s must be one of: %s (got %q)", name, strings.Join(allowed, ", "), value)
+	value = ""
+	return
+}
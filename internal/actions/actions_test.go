@@ -2,10 +2,12 @@ package actions
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -133,6 +135,226 @@ func TestLogger_SetSecret(t *testing.T) {
 	}
 }
 
+func TestLogger_Notice(t *testing.T) {
+	logger := &Logger{Output: &strings.Builder{}}
+	logger.Notice(content)
+
+	diff := cmp.Diff("::notice::"+content+"\n", logger.Output.(*strings.Builder).String())
+	if diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogger_Noticef(t *testing.T) {
+	logger := &Logger{Output: &strings.Builder{}}
+	logger.Noticef(format, content, number)
+
+	diff := cmp.Diff(
+		"::notice::"+content+" "+strconv.Itoa(number)+"\n",
+		logger.Output.(*strings.Builder).String(),
+	)
+
+	if diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogger_Annotations(t *testing.T) {
+	testCases := []struct {
+		name     string
+		log      func(l *Logger, message string, properties AnnotationProperties)
+		props    AnnotationProperties
+		expected string
+	}{
+		{
+			name:     "error_without_properties",
+			log:      (*Logger).ErrorAnnotation,
+			expected: "::error::" + content + "\n",
+		},
+		{
+			name: "error_with_all_properties",
+			log:  (*Logger).ErrorAnnotation,
+			props: AnnotationProperties{
+				Title: "Upload failed", File: ".github/workflows/docs.yml",
+				Line: 3, Col: 5, EndLine: 4, EndColumn: 10,
+			},
+			expected: "::error title=Upload failed,file=.github/workflows/docs.yml," +
+				"line=3,col=5,endLine=4,endColumn=10::" + content + "\n",
+		},
+		{
+			name:     "warning_with_file",
+			log:      (*Logger).WarnAnnotation,
+			props:    AnnotationProperties{File: "README.md", Line: 1},
+			expected: "::warning file=README.md,line=1::" + content + "\n",
+		},
+		{
+			name:     "notice_with_title",
+			log:      (*Logger).NoticeAnnotation,
+			props:    AnnotationProperties{Title: "Deploy"},
+			expected: "::notice title=Deploy::" + content + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &Logger{Output: &strings.Builder{}}
+			tc.log(logger, content, tc.props)
+
+			if diff := cmp.Diff(tc.expected, logger.Output.(*strings.Builder).String()); diff != "" {
+				t.Errorf("Output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLogger_Group(t *testing.T) {
+	logger := &Logger{Output: &strings.Builder{}}
+	logger.Group("Uploading files")
+	logger.Info(content)
+	logger.EndGroup()
+
+	diff := cmp.Diff(
+		"::group::Uploading files\n"+content+"\n::endgroup::\n",
+		logger.Output.(*strings.Builder).String(),
+	)
+
+	if diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogger_StopCommands(t *testing.T) {
+	logger := &Logger{Output: &strings.Builder{}}
+
+	token := logger.StopCommands()
+	if token == "" {
+		t.Fatal("Expected a token")
+	}
+
+	logger.Info("::error::not a command")
+	logger.ResumeCommands(token)
+
+	diff := cmp.Diff(
+		"::stop-commands::"+token+"\n::error::not a command\n::"+token+"::\n",
+		logger.Output.(*strings.Builder).String(),
+	)
+
+	if diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogger_Echo(t *testing.T) {
+	logger := &Logger{Output: &strings.Builder{}}
+	logger.Echo(true)
+	logger.Echo(false)
+
+	diff := cmp.Diff("::echo::on\n::echo::off\n", logger.Output.(*strings.Builder).String())
+	if diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_escapeData(t *testing.T) {
+	testCases := []struct {
+		name   string
+		data   string
+		result string
+	}{
+		{name: "plain", data: "lorem ipsum", result: "lorem ipsum"},
+		{name: "percent", data: "100% done", result: "100%25 done"},
+		{name: "newlines", data: "first\r\nsecond\nthird", result: "first%0D%0Asecond%0Athird"},
+		{name: "escaped_sequence", data: "%0A", result: "%250A"},
+		{name: "colons_and_commas", data: "a: b, c", result: "a: b, c"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.result, escapeData(tc.data)); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_escapeProperty(t *testing.T) {
+	testCases := []struct {
+		name   string
+		value  string
+		result string
+	}{
+		{name: "plain", value: "README.md", result: "README.md"},
+		{name: "percent", value: "50%", result: "50%25"},
+		{name: "newlines", value: "a\r\nb", result: "a%0D%0Ab"},
+		{name: "colon", value: "Error: failed", result: "Error%3A failed"},
+		{name: "comma", value: "one, two", result: "one%2C two"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.result, escapeProperty(tc.value)); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLogger_Error_Escaped(t *testing.T) {
+	logger := &Logger{Output: &strings.Builder{}}
+	logger.ErrorAnnotation(
+		"upload of /docs/100%.pdf failed:\nstatus 422",
+		AnnotationProperties{Title: "Netlify: upload, retry", File: "docs/a,b.yml"},
+	)
+
+	diff := cmp.Diff(
+		"::error title=Netlify%3A upload%2C retry,file=docs/a%2Cb.yml::upload of /docs/100%25.pdf failed:%0Astatus 422\n",
+		logger.Output.(*strings.Builder).String(),
+	)
+
+	if diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogger_SetSecret_Multiline(t *testing.T) {
+	testCases := []struct {
+		name     string
+		secret   string
+		expected string
+	}{
+		{
+			name:     "lines",
+			secret:   "first\nsecond",
+			expected: "::add-mask::first\n::add-mask::second\n",
+		},
+		{
+			name:     "crlf_and_blank_lines",
+			secret:   "first\r\n\r\n  \nsecond\n",
+			expected: "::add-mask::first\n::add-mask::second\n",
+		},
+		{
+			name:     "percent",
+			secret:   "p%ss",
+			expected: "::add-mask::p%25ss\n",
+		},
+		{
+			name:   "empty",
+			secret: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &Logger{Output: &strings.Builder{}}
+			logger.SetSecret(tc.secret)
+
+			if diff := cmp.Diff(tc.expected, logger.Output.(*strings.Builder).String()); diff != "" {
+				t.Errorf("Output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 type testGetInput struct {
 	name          string
 	value         string
@@ -295,3 +517,216 @@ func Test_GetMultilineInput(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetInput_Default(t *testing.T) {
+	t.Setenv("INPUT_KEY", "")
+
+	result, err := GetInput(environmentKey, GetInputOptions{Required: true, Default: "fallback"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff("fallback", result); diff != "" {
+		t.Errorf("Value mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_GetBooleanInput(t *testing.T) {
+	testCases := []struct {
+		result bool
+		testGetInput
+	}{
+		{result: true, testGetInput: testGetInput{name: "true", value: "true"}},
+		{result: true, testGetInput: testGetInput{name: "title_case", value: "True"}},
+		{result: true, testGetInput: testGetInput{name: "upper_case", value: " TRUE "}},
+		{result: false, testGetInput: testGetInput{name: "false", value: "FALSE"}},
+		{result: false, testGetInput: testGetInput{name: "missing", value: ""}},
+		{
+			result: true,
+			testGetInput: testGetInput{
+				name: "default", value: "", options: GetInputOptions{Default: "true"},
+			},
+		},
+		{
+			testGetInput: testGetInput{
+				name:  "yaml_1_1_value",
+				value: "yes",
+				expectedError: fmt.Errorf(
+					"input %s must be one of: true, True, TRUE, false, False, FALSE (got %q)", environmentKey, "yes",
+				),
+			},
+		},
+		{
+			testGetInput: testGetInput{
+				name:    "required_with_missing_value",
+				value:   "",
+				options: GetInputOptions{Required: true},
+				expectedError: fmt.Errorf(
+					"input %s is required but was not given", environmentKey,
+				),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("INPUT_KEY", tc.value)
+
+			result, err := GetBooleanInput(environmentKey, tc.options)
+			if diff := cmp.Diff(tc.expectedError, err, compareErrors); diff != "" {
+				t.Errorf("Error mismatch (-want +got):\n%s", diff)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, result); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_GetIntegerInput(t *testing.T) {
+	testCases := []struct {
+		min, max int
+		result   int
+		testGetInput
+	}{
+		{min: 1, max: 10, result: 4, testGetInput: testGetInput{name: "in_range", value: "4"}},
+		{min: 0, max: 10, result: 0, testGetInput: testGetInput{name: "missing", value: ""}},
+		{
+			min: 1, max: 10,
+			testGetInput: testGetInput{
+				name:  "missing_out_of_range",
+				value: "",
+				expectedError: fmt.Errorf(
+					"input %s must be an integer from %d to %d (got %q)", environmentKey, 1, 10, "",
+				),
+			},
+		},
+		{
+			min: 1, max: 10, result: 3,
+			testGetInput: testGetInput{name: "default", value: "", options: GetInputOptions{Default: "3"}},
+		},
+		{
+			min: 1, max: 10,
+			testGetInput: testGetInput{
+				name:  "out_of_range",
+				value: "11",
+				expectedError: fmt.Errorf(
+					"input %s must be an integer from %d to %d (got %q)", environmentKey, 1, 10, "11",
+				),
+			},
+		},
+		{
+			min: 0, max: math.MaxInt,
+			testGetInput: testGetInput{
+				name:  "not_a_number",
+				value: "three",
+				expectedError: fmt.Errorf(
+					"input %s must be an integer of at least %d (got %q)", environmentKey, 0, "three",
+				),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("INPUT_KEY", tc.value)
+
+			result, err := GetIntegerInput(environmentKey, tc.min, tc.max, tc.options)
+			if diff := cmp.Diff(tc.expectedError, err, compareErrors); diff != "" {
+				t.Errorf("Error mismatch (-want +got):\n%s", diff)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, result); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_GetDurationInput(t *testing.T) {
+	testCases := []struct {
+		result time.Duration
+		testGetInput
+	}{
+		{result: 90 * time.Second, testGetInput: testGetInput{name: "duration", value: "1m30s"}},
+		{result: 0, testGetInput: testGetInput{name: "missing", value: ""}},
+		{
+			testGetInput: testGetInput{
+				name:  "negative",
+				value: "-1s",
+				expectedError: fmt.Errorf(
+					"input %s must be a non-negative duration such as 500ms, 30s, or 5m (got %q)", environmentKey, "-1s",
+				),
+			},
+		},
+		{
+			testGetInput: testGetInput{
+				name:  "missing_unit",
+				value: "30",
+				expectedError: fmt.Errorf(
+					"input %s must be a non-negative duration such as 500ms, 30s, or 5m (got %q)", environmentKey, "30",
+				),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("INPUT_KEY", tc.value)
+
+			result, err := GetDurationInput(environmentKey, tc.options)
+			if diff := cmp.Diff(tc.expectedError, err, compareErrors); diff != "" {
+				t.Errorf("Error mismatch (-want +got):\n%s", diff)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, result); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_GetEnumInput(t *testing.T) {
+	allowed := []string{"fail", "empty", "production"}
+
+	testCases := []struct {
+		result string
+		testGetInput
+	}{
+		{result: "empty", testGetInput: testGetInput{name: "allowed", value: "empty"}},
+		{result: "", testGetInput: testGetInput{name: "missing", value: ""}},
+		{
+			result:       "fail",
+			testGetInput: testGetInput{name: "default", value: "", options: GetInputOptions{Default: "fail"}},
+		},
+		{
+			testGetInput: testGetInput{
+				name:  "not_allowed",
+				value: "Empty",
+				expectedError: fmt.Errorf(
+					"input %s must be one of: fail, empty, production (got %q)", environmentKey, "Empty",
+				),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("INPUT_KEY", tc.value)
+
+			result, err := GetEnumInput(environmentKey, allowed, tc.options)
+			if diff := cmp.Diff(tc.expectedError, err, compareErrors); diff != "" {
+				t.Errorf("Error mismatch (-want +got):\n%s", diff)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, result); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
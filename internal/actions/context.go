@@ -0,0 +1,114 @@
+package actions
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Context contains information about the workflow run, read from the environment variables set by
+// Github actions.
+type Context struct {
+	ServerURL   string
+	Repository  string
+	SHA         string
+	Ref         string
+	RefName     string
+	EventName   string
+	Workflow    string
+	WorkflowRef string
+	Actor       string
+	RunID       string
+	RunNumber   string
+	RunAttempt  string
+
+	// PRNumber is the number of the pull request that triggered the run, or zero.
+	PRNumber int
+}
+
+// GetContext reads the context of the current workflow run.
+func GetContext() (c Context) {
+	c = Context{
+		ServerURL:   os.Getenv("GITHUB_SERVER_URL"),
+		Repository:  os.Getenv("GITHUB_REPOSITORY"),
+		SHA:         os.Getenv("GITHUB_SHA"),
+		Ref:         os.Getenv("GITHUB_REF"),
+		RefName:     os.Getenv("GITHUB_REF_NAME"),
+		EventName:   os.Getenv("GITHUB_EVENT_NAME"),
+		Workflow:    os.Getenv("GITHUB_WORKFLOW"),
+		WorkflowRef: os.Getenv("GITHUB_WORKFLOW_REF"),
+		Actor:       os.Getenv("GITHUB_ACTOR"),
+		RunID:       os.Getenv("GITHUB_RUN_ID"),
+		RunNumber:   os.Getenv("GITHUB_RUN_NUMBER"),
+		RunAttempt:  os.Getenv("GITHUB_RUN_ATTEMPT"),
+	}
+
+	if c.ServerURL == "" {
+		c.ServerURL = "https://github.com"
+	}
+
+	c.PRNumber = pullRequestNumber(os.Getenv("GITHUB_EVENT_PATH"), c.Ref)
+	return
+}
+
+// pullRequestNumber reads the pull request number from the event payload, falling back to the
+// refs/pull/<number>/merge ref of pull request events.
+func pullRequestNumber(eventPath, ref string) (number int) {
+	if content, err := os.ReadFile(eventPath); err == nil {
+		var event struct {
+			PullRequest struct {
+				Number int `json:"number"`
+			} `json:"pull_request"`
+		}
+
+		if json.Unmarshal(content, &event) == nil && event.PullRequest.Number > 0 {
+			number = event.PullRequest.Number
+			return
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(ref, "refs/pull/"); ok {
+		number, _ = strconv.Atoi(strings.SplitN(rest, "/", 2)[0])
+	}
+
+	return
+}
+
+// ShortSHA returns the first seven characters of the commit SHA.
+func (c Context) ShortSHA() string {
+	if len(c.SHA) > 7 {
+		return c.SHA[:7]
+	}
+
+	return c.SHA
+}
+
+// RunURL returns the URL of the workflow run, or an empty string outside of a workflow run.
+func (c Context) RunURL() string {
+	if c.Repository == "" || c.RunID == "" {
+		return ""
+	}
+
+	return c.ServerURL + "/" + c.Repository + "/actions/runs/" + c.RunID
+}
+
+// CommitURL returns the URL of the commit, or an empty string outside of a workflow run.
+func (c Context) CommitURL() string {
+	if c.Repository == "" || c.SHA == "" {
+		return ""
+	}
+
+	return c.ServerURL + "/" + c.Repository + "/commit/" + c.SHA
+}
+
+// WorkflowFile returns the path of the workflow file in the repository, such as
+// .github/workflows/docs.yml, or an empty string if it is unknown.
+func (c Context) WorkflowFile() string {
+	path, _, _ := strings.Cut(c.WorkflowRef, "@")
+	if path == "" || c.Repository == "" {
+		return ""
+	}
+
+	return strings.TrimPrefix(path, c.Repository+"/")
+}
@@ -0,0 +1,83 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_GetContext(t *testing.T) {
+	event := filepath.Join(t.TempDir(), "event.json")
+	if err := os.WriteFile(event, []byte(`{"number": 7, "pull_request": {"number": 7}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GITHUB_SERVER_URL", "")
+	t.Setenv("GITHUB_REPOSITORY", "octocat/docs")
+	t.Setenv("GITHUB_SHA", "1a2b3c4d5e6f")
+	t.Setenv("GITHUB_REF", "refs/pull/7/merge")
+	t.Setenv("GITHUB_REF_NAME", "7/merge")
+	t.Setenv("GITHUB_EVENT_NAME", "pull_request")
+	t.Setenv("GITHUB_EVENT_PATH", event)
+	t.Setenv("GITHUB_WORKFLOW", "Docs")
+	t.Setenv("GITHUB_WORKFLOW_REF", "octocat/docs/.github/workflows/docs.yml@refs/pull/7/merge")
+	t.Setenv("GITHUB_ACTOR", "octocat")
+	t.Setenv("GITHUB_RUN_ID", "42")
+	t.Setenv("GITHUB_RUN_NUMBER", "3")
+	t.Setenv("GITHUB_RUN_ATTEMPT", "1")
+
+	expected := Context{
+		ServerURL:   "https://github.com",
+		Repository:  "octocat/docs",
+		SHA:         "1a2b3c4d5e6f",
+		Ref:         "refs/pull/7/merge",
+		RefName:     "7/merge",
+		EventName:   "pull_request",
+		Workflow:    "Docs",
+		WorkflowRef: "octocat/docs/.github/workflows/docs.yml@refs/pull/7/merge",
+		Actor:       "octocat",
+		RunID:       "42",
+		RunNumber:   "3",
+		RunAttempt:  "1",
+		PRNumber:    7,
+	}
+
+	c := GetContext()
+	if diff := cmp.Diff(expected, c); diff != "" {
+		t.Fatalf("Context mismatch (-want +got):\n%s", diff)
+	}
+
+	urls := []string{c.ShortSHA(), c.RunURL(), c.CommitURL(), c.WorkflowFile()}
+	expectedURLs := []string{
+		"1a2b3c4",
+		"https://github.com/octocat/docs/actions/runs/42",
+		"https://github.com/octocat/docs/commit/1a2b3c4d5e6f",
+		".github/workflows/docs.yml",
+	}
+
+	if diff := cmp.Diff(expectedURLs, urls); diff != "" {
+		t.Errorf("Derived values mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_pullRequestNumber(t *testing.T) {
+	testCases := []struct {
+		name   string
+		ref    string
+		result int
+	}{
+		{name: "pull_request_ref", ref: "refs/pull/12/merge", result: 12},
+		{name: "branch_ref", ref: "refs/heads/main", result: 0},
+		{name: "empty", ref: "", result: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.result, pullRequestNumber("", tc.ref)); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
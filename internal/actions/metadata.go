@@ -0,0 +1,120 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mrflynn/upload-to-netlify-action/internal/fuzzy"
+	"gopkg.in/yaml.v2"
+)
+
+// InputSchema describes an input of the action as declared in action.yml.
+type InputSchema struct {
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+	Default     string `yaml:"default"`
+}
+
+// Metadata is the part of action.yml that describes the inputs of the action.
+type Metadata struct {
+	Inputs map[string]InputSchema `yaml:"inputs"`
+}
+
+// ParseMetadata parses the contents of an action.yml file.
+func ParseMetadata(content []byte) (metadata Metadata, err error) {
+	err = yaml.Unmarshal(content, &metadata)
+	if err != nil {
+		err = fmt.Errorf("could not parse action metadata: %w", err)
+	}
+
+	return
+}
+
+// Options returns the options for getting the named input, with Required and Default taken from the
+// schema. Whitespace is always trimmed.
+func (m Metadata) Options(name string) (options GetInputOptions, err error) {
+	schema, ok := m.Inputs[name]
+	if !ok {
+		err = fmt.Errorf("input %s is not declared in action.yml", name)
+		return
+	}
+
+	options = GetInputOptions{
+		Required:       schema.Required,
+		TrimWhitespace: true,
+		Default:        schema.Default,
+	}
+
+	return
+}
+
+// UnknownInput is an INPUT_ environment variable that does not belong to any declared input.
+type UnknownInput struct {
+	Variable string
+
+	// Suggestion is the declared input with the most similar name, if any is similar enough.
+	Suggestion string
+}
+
+func (u UnknownInput) String() string {
+	name := strings.ToLower(strings.TrimPrefix(u.Variable, "INPUT_"))
+	if u.Suggestion == "" {
+		return fmt.Sprintf("unknown input %s", name)
+	}
+
+	return fmt.Sprintf("unknown input %s, did you mean %s?", name, u.Suggestion)
+}
+
+// UnknownInputs returns the INPUT_ variables in environ that do not belong to a declared input,
+// sorted by name. If environ is nil, the environment of the process is used.
+func (m Metadata) UnknownInputs(environ []string) (unknown []UnknownInput) {
+	if environ == nil {
+		environ = os.Environ()
+	}
+
+	known := make(map[string]bool, len(m.Inputs))
+	for name := range m.Inputs {
+		known[inputVariable(name)] = true
+	}
+
+	for _, entry := range environ {
+		variable, _, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(variable, "INPUT_") || known[variable] {
+			continue
+		}
+
+		unknown = append(unknown, UnknownInput{
+			Variable:   variable,
+			Suggestion: m.suggest(strings.ToLower(strings.TrimPrefix(variable, "INPUT_"))),
+		})
+	}
+
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i].Variable < unknown[j].Variable
+	})
+
+	return
+}
+
+// suggest returns the declared input closest to name, as long as less than a third of it differs.
+func (m Metadata) suggest(name string) (suggestion string) {
+	best := fuzzy.MaxDistance(name) + 1
+
+	names := make([]string, 0, len(m.Inputs))
+	for input := range m.Inputs {
+		names = append(names, input)
+	}
+
+	sort.Strings(names)
+
+	for _, input := range names {
+		candidate := strings.ToLower(strings.TrimPrefix(inputVariable(input), "INPUT_"))
+		if distance := fuzzy.Distance(name, candidate); distance < best {
+			best, suggestion = distance, input
+		}
+	}
+
+	return
+}
@@ -0,0 +1,139 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testMetadata = `
+name: Test
+inputs:
+  source-file:
+    description: File to upload.
+    required: false
+  destination-path:
+    description: Where to upload the file.
+    required: false
+  upload-concurrency:
+    description: Number of parallel uploads.
+    required: false
+    default: "4"
+  draft:
+    description: Create a draft deploy.
+    required: false
+    default: false
+  netlify-token:
+    description: API token.
+    required: true
+runs:
+  using: docker
+`
+
+func Test_ParseMetadata(t *testing.T) {
+	metadata, err := ParseMetadata([]byte(testMetadata))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := Metadata{
+		Inputs: map[string]InputSchema{
+			"source-file":        {Description: "File to upload."},
+			"destination-path":   {Description: "Where to upload the file."},
+			"upload-concurrency": {Description: "Number of parallel uploads.", Default: "4"},
+			"draft":              {Description: "Create a draft deploy.", Default: "false"},
+			"netlify-token":      {Description: "API token.", Required: true},
+		},
+	}
+
+	if diff := cmp.Diff(expected, metadata); diff != "" {
+		t.Errorf("Metadata mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMetadata_Options(t *testing.T) {
+	metadata, err := ParseMetadata([]byte(testMetadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		input         string
+		result        GetInputOptions
+		expectedError error
+	}{
+		{
+			name:   "default",
+			input:  "upload-concurrency",
+			result: GetInputOptions{TrimWhitespace: true, Default: "4"},
+		},
+		{
+			name:   "required",
+			input:  "netlify-token",
+			result: GetInputOptions{Required: true, TrimWhitespace: true},
+		},
+		{
+			name:          "undeclared",
+			input:         "site-name",
+			expectedError: errors.New("input site-name is not declared in action.yml"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := metadata.Options(tc.input)
+			if diff := cmp.Diff(tc.expectedError, err, compareErrors); diff != "" {
+				t.Errorf("Error mismatch (-want +got):\n%s", diff)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, result); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMetadata_UnknownInputs(t *testing.T) {
+	metadata, err := ParseMetadata([]byte(testMetadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	environ := []string{
+		"PATH=/usr/bin",
+		"INPUT_SOURCE-FILE=report.pdf",
+		"INPUT_DESTINATION-PATHS=/reports/report.pdf",
+		"INPUT_UPLOAD_CONCURRENCY=8",
+		"INPUT_COLOR=blue",
+		"INPUT_NETLIFY-TOKEN=secret",
+	}
+
+	expected := []UnknownInput{
+		{Variable: "INPUT_COLOR"},
+		{Variable: "INPUT_DESTINATION-PATHS", Suggestion: "destination-path"},
+		{Variable: "INPUT_UPLOAD_CONCURRENCY", Suggestion: "upload-concurrency"},
+	}
+
+	unknown := metadata.UnknownInputs(environ)
+	if diff := cmp.Diff(expected, unknown); diff != "" {
+		t.Fatalf("Unknown inputs mismatch (-want +got):\n%s", diff)
+	}
+
+	messages := make([]string, len(unknown))
+	for i, u := range unknown {
+		messages[i] = u.String()
+	}
+
+	expectedMessages := []string{
+		"unknown input color",
+		"unknown input destination-paths, did you mean destination-path?",
+		"unknown input upload_concurrency, did you mean upload-concurrency?",
+	}
+
+	if diff := cmp.Diff(expectedMessages, messages); diff != "" {
+		t.Errorf("Messages mismatch (-want +got):\n%s", diff)
+	}
+}
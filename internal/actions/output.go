@@ -0,0 +1,75 @@
+package actions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SetOutput sets an output of the step that later steps can read through the steps context. Values
+// containing newlines are written with a random delimiter.
+func SetOutput(name, value string) (err error) {
+	err = appendKeyValue("GITHUB_OUTPUT", name, value)
+	return
+}
+
+// appendKeyValue appends a name and value to the environment file that the given environment
+// variable points to.
+func appendKeyValue(env, name, value string) (err error) {
+	var message string
+	message, err = keyValueMessage(name, value)
+	if err != nil {
+		return
+	}
+
+	err = appendToFile(env, message)
+	return
+}
+
+// appendToFile appends content to the file that the given environment variable points to.
+func appendToFile(env, content string) (err error) {
+	path := os.Getenv(env)
+	if path == "" {
+		err = fmt.Errorf("%s is not set", env)
+		return
+	}
+
+	var file *os.File
+	file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		err = fmt.Errorf("could not open %s: %w", env, err)
+		return
+	}
+
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return
+}
+
+// keyValueMessage formats a name and value for an environment file. Single line values are written
+// as name=value, anything else uses the name<<delimiter syntax.
+func keyValueMessage(name, value string) (message string, err error) {
+	if !strings.ContainsAny(value, "\r\n") {
+		message = name + "=" + value + "\n"
+		return
+	}
+
+	random := make([]byte, 16)
+	if _, err = rand.Read(random); err != nil {
+		return
+	}
+
+	delimiter := "ghadelimiter_" + hex.EncodeToString(random)
+	if strings.Contains(name, delimiter) || strings.Contains(value, delimiter) {
+		err = fmt.Errorf("value of %s contains the delimiter %s", name, delimiter)
+		return
+	}
+
+	message = name + "<<" + delimiter + "\n" + value + "\n" + delimiter + "\n"
+	return
+}
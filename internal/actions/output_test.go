@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_SetOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output")
+	t.Setenv("GITHUB_OUTPUT", path)
+
+	if err := SetOutput("deploy-id", "abc123"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if err := SetOutput("uploaded-urls", "https://example.com/a.pdf\nhttps://example.com/b.pdf"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delimiter := regexp.MustCompile(`ghadelimiter_[0-9a-f]{32}`).FindString(string(content))
+	if delimiter == "" {
+		t.Fatalf("Expected a delimiter in output file, got:\n%s", content)
+	}
+
+	expected := "deploy-id=abc123\n" +
+		"uploaded-urls<<" + delimiter + "\n" +
+		"https://example.com/a.pdf\nhttps://example.com/b.pdf\n" +
+		delimiter + "\n"
+
+	if diff := cmp.Diff(expected, string(content)); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_SetOutput_MissingFile(t *testing.T) {
+	t.Setenv("GITHUB_OUTPUT", "")
+
+	if err := SetOutput("deploy-id", "abc123"); err == nil {
+		t.Error("Expected an error when GITHUB_OUTPUT is not set")
+	}
+}
@@ -0,0 +1,105 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Summary builds a Markdown job summary that is shown on the summary page of the workflow run.
+type Summary struct {
+	buffer strings.Builder
+}
+
+// NewSummary creates an empty summary.
+func NewSummary() *Summary {
+	return &Summary{}
+}
+
+// Heading adds a heading of the given level, from 1 to 6.
+func (s *Summary) Heading(level int, text string) *Summary {
+	if level < 1 {
+		level = 1
+	} else if level > 6 {
+		level = 6
+	}
+
+	s.block(strings.Repeat("#", level) + " " + text)
+	return s
+}
+
+// Paragraph adds a paragraph of text.
+func (s *Summary) Paragraph(text string) *Summary {
+	s.block(text)
+	return s
+}
+
+// List adds a bulleted list.
+func (s *Summary) List(items ...string) *Summary {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = "- " + item
+	}
+
+	s.block(strings.Join(lines, "\n"))
+	return s
+}
+
+// Table adds a table with the given header. Cells are escaped so that they cannot break the table.
+func (s *Summary) Table(header []string, rows [][]string) *Summary {
+	var b strings.Builder
+
+	writeRow := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" " + escapeTableCell(cell) + " |")
+		}
+
+		b.WriteString("\n")
+	}
+
+	writeRow(header)
+
+	b.WriteString("|")
+	for range header {
+		b.WriteString(" --- |")
+	}
+
+	b.WriteString("\n")
+
+	for _, row := range rows {
+		writeRow(row)
+	}
+
+	s.block(strings.TrimSuffix(b.String(), "\n"))
+	return s
+}
+
+// Link returns a Markdown link to url with the given text.
+func Link(text, url string) string {
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+// Code returns text formatted as inline code.
+func Code(text string) string {
+	return "`" + strings.ReplaceAll(text, "`", "'") + "`"
+}
+
+// String returns the Markdown of the summary.
+func (s *Summary) String() string {
+	return s.buffer.String()
+}
+
+// Write appends the summary to the file that GITHUB_STEP_SUMMARY points to.
+func (s *Summary) Write() error {
+	return appendToFile("GITHUB_STEP_SUMMARY", s.String())
+}
+
+func (s *Summary) block(markdown string) {
+	s.buffer.WriteString(markdown + "\n\n")
+}
+
+func escapeTableCell(cell string) string {
+	cell = strings.ReplaceAll(cell, "|", `\|`)
+	cell = strings.ReplaceAll(cell, "\r\n", "<br>")
+	return strings.ReplaceAll(cell, "\n", "<br>")
+}
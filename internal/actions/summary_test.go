@@ -0,0 +1,55 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSummary_String(t *testing.T) {
+	summary := NewSummary().
+		Heading(2, "Netlify Upload").
+		List("Site: "+Code("docs"), "Deploy: "+Link("abc123", "https://abc123--docs.netlify.app")).
+		Table([]string{"File", "Status"}, [][]string{
+			{"/a|b.pdf", "uploaded"},
+			{"/notes.txt", "already\npresent"},
+		}).
+		Paragraph("Done.")
+
+	expected := "## Netlify Upload\n\n" +
+		"- Site: `docs`\n" +
+		"- Deploy: [abc123](https://abc123--docs.netlify.app)\n\n" +
+		"| File | Status |\n" +
+		"| --- | --- |\n" +
+		"| /a\\|b.pdf | uploaded |\n" +
+		"| /notes.txt | already<br>present |\n\n" +
+		"Done.\n\n"
+
+	if diff := cmp.Diff(expected, summary.String()); diff != "" {
+		t.Errorf("Summary mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSummary_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv("GITHUB_STEP_SUMMARY", path)
+
+	if err := os.WriteFile(path, []byte("Earlier step\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewSummary().Heading(1, "Upload").Write(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff("Earlier step\n\n# Upload\n\n", string(content)); diff != "" {
+		t.Errorf("Summary file mismatch (-want +got):\n%s", diff)
+	}
+}
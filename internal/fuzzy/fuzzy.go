@@ -0,0 +1,42 @@
+// Package fuzzy finds near matches for names that were probably mistyped.
+package fuzzy
+
+// Distance returns the number of single character edits needed to turn a into b.
+func Distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// MaxDistance returns the largest distance at which a name is still considered a typo of the given
+// one, which is when less than a third of it differs.
+func MaxDistance(name string) int {
+	return len(name) / 3
+}
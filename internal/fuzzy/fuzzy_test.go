@@ -0,0 +1,28 @@
+package fuzzy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDistance(t *testing.T) {
+	testCases := []struct {
+		a, b   string
+		result int
+	}{
+		{a: "", b: "", result: 0},
+		{a: "draft", b: "", result: 5},
+		{a: "destination-paths", b: "destination-path", result: 1},
+		{a: "kitten", b: "sitting", result: 3},
+		{a: "my-stie", b: "my-site", result: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+"_"+tc.b, func(t *testing.T) {
+			if diff := cmp.Diff(tc.result, Distance(tc.a, tc.b)); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,667 @@
+// Package netlifytest provides an in-process fake of the parts of the Netlify API used by this
+// action, so that the upload flow can be tested without a Netlify account.
+package netlifytest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/runtime/client"
+	"github.com/netlify/open-api/v2/go/models"
+	"github.com/netlify/open-api/v2/go/plumbing"
+)
+
+// Server is a fake Netlify API. Deploys move through the same states as on Netlify: a new deploy is
+// "prepared" while Netlify waits for the files it requires, "uploading" once the first of them has been
+// received, "processing" once all of them have, and "ready" after it has been polled ProcessingPolls
+// times. Ready deploys that are not drafts become the
+// published deploy of their site.
+type Server struct {
+	*httptest.Server
+
+	// Token is the bearer token expected on every request. If empty, requests are not authenticated.
+	Token string
+
+	// ProcessingPolls is the number of times a processing deploy is returned before it becomes ready.
+	ProcessingPolls int
+
+	mu       sync.Mutex
+	nextID   int
+	sites    []*models.Site
+	deploys  []*deploy
+	blobs    map[string][]byte
+	digests  map[string]bool
+	failures []*failure
+	requests []string
+}
+
+type deploy struct {
+	model *models.Deploy
+	files map[string]string
+	polls int
+
+	functions     map[string]string
+	edgeFunctions bool
+}
+
+type failure struct {
+	method string
+	path   string
+	count  int
+	status int
+	header http.Header
+}
+
+// NewServer starts a fake Netlify API that is shut down when the test finishes.
+func NewServer(t testing.TB) (s *Server) {
+	s = &Server{
+		ProcessingPolls: 1,
+		blobs:           map[string][]byte{},
+		digests:         map[string]bool{},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+
+	return
+}
+
+// Transport returns a client transport that sends requests to the server.
+func (s *Server) Transport() runtime.ClientTransport {
+	u, _ := url.Parse(s.URL)
+	return client.New(u.Host, plumbing.DefaultBasePath, []string{u.Scheme})
+}
+
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%024x", s.nextID)
+}
+
+// AddSite registers a site with the server. An ID is assigned if the site does not have one.
+func (s *Server) AddSite(site *models.Site) *models.Site {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if site.ID == "" {
+		site.ID = s.newID()
+	}
+
+	if site.URL == "" {
+		site.URL = "https://" + site.Name + ".netlify.app"
+	}
+
+	s.sites = append(s.sites, site)
+	return site
+}
+
+// AddDeploy registers a deploy of the site with the given file contents, keyed by path. The deploy
+// is ready unless its state is set, and becomes the published deploy of the site if it is ready and
+// not a draft.
+func (s *Server) AddDeploy(siteID string, d *models.Deploy, files map[string][]byte) *models.Deploy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d.ID == "" {
+		d.ID = s.newID()
+	}
+
+	if d.State == "" {
+		d.State = "ready"
+	}
+
+	d.SiteID = siteID
+
+	record := &deploy{model: d, files: map[string]string{}}
+	for p, content := range files {
+		sha := s.storeBlob(content)
+		record.files[p] = sha
+	}
+
+	s.deploys = append(s.deploys, record)
+	s.publish(record)
+
+	return d
+}
+
+// SetDeployFunctions sets the serverless functions of a deploy as a map of name to digest, and
+// whether the deploy has edge functions. The digests are known to the server afterwards.
+func (s *Server) SetDeployFunctions(id string, functions map[string]string, edgeFunctions bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.findDeploy(id); d != nil {
+		d.functions = functions
+		d.edgeFunctions = edgeFunctions
+
+		for _, digest := range functions {
+			s.digests[digest] = true
+		}
+	}
+}
+
+// DeployFunctions returns the serverless functions of the deploy as a map of name to digest.
+func (s *Server) DeployFunctions(id string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	functions := map[string]string{}
+	if d := s.findDeploy(id); d != nil {
+		for name, digest := range d.functions {
+			functions[name] = digest
+		}
+	}
+
+	return functions
+}
+
+// ForgetFunction removes a function digest from the server, as if it had expired.
+func (s *Server) ForgetFunction(digest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.digests, digest)
+}
+
+// FailRequests makes the next count requests with the given method and path fail with status. The
+// path is relative to the API base path, e.g. /sites/{site_id}/deploys.
+func (s *Server) FailRequests(method, path string, count, status int, header http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, &failure{
+		method: method,
+		path:   path,
+		count:  count,
+		status: status,
+		header: header,
+	})
+}
+
+// Requests returns every request received so far as "METHOD /path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// Deploy returns the current state of the deploy with the given ID, or nil.
+func (s *Server) Deploy(id string) *models.Deploy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.findDeploy(id); d != nil {
+		copied := *d.model
+		return &copied
+	}
+
+	return nil
+}
+
+// DeployFiles returns the files of the deploy with the given ID as a map of path to SHA1.
+func (s *Server) DeployFiles(id string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := map[string]string{}
+	if d := s.findDeploy(id); d != nil {
+		for p, sha := range d.files {
+			files[p] = sha
+		}
+	}
+
+	return files
+}
+
+// Blob returns the uploaded content with the given SHA1.
+func (s *Server) Blob(sha string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.blobs[sha]
+	return content, ok
+}
+
+func (s *Server) storeBlob(content []byte) string {
+	sum := sha1.Sum(content)
+	sha := hex.EncodeToString(sum[:])
+	s.blobs[sha] = content
+
+	return sha
+}
+
+func (s *Server) findSite(id string) *models.Site {
+	for _, site := range s.sites {
+		if site.ID == id {
+			return site
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) findDeploy(id string) *deploy {
+	for _, d := range s.deploys {
+		if d.model.ID == id {
+			return d
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) publish(d *deploy) {
+	if d.model.State != "ready" || d.model.Draft {
+		return
+	}
+
+	if site := s.findSite(d.model.SiteID); site != nil {
+		copied := *d.model
+		site.PublishedDeploy = &copied
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), plumbing.DefaultBasePath), "/") {
+		if segment == "" {
+			continue
+		}
+
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		segments = append(segments, unescaped)
+	}
+
+	route := r.Method + " /" + strings.Join(segments, "/")
+	s.requests = append(s.requests, route)
+
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeError(w, http.StatusUnauthorized, "Access Denied")
+		return
+	}
+
+	for _, f := range s.failures {
+		if f.count > 0 && f.method == r.Method && f.path == "/"+strings.Join(segments, "/") {
+			f.count--
+
+			for key, values := range f.header {
+				w.Header()[key] = values
+			}
+
+			writeError(w, f.status, http.StatusText(f.status))
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && match(segments, "sites"):
+		s.listSites(w, r)
+	case r.Method == http.MethodGet && match(segments, "sites", "*"):
+		s.getSite(w, segments[1])
+	case r.Method == http.MethodGet && match(segments, "sites", "*", "deploys"):
+		s.listSiteDeploys(w, r, segments[1])
+	case r.Method == http.MethodPost && match(segments, "sites", "*", "deploys"):
+		s.createSiteDeploy(w, r, segments[1])
+	case r.Method == http.MethodGet && match(segments, "sites", "*", "deploys", "*"):
+		s.getSiteDeploy(w, segments[1], segments[3])
+	case r.Method == http.MethodPost && match(segments, "sites", "*", "deploys", "*", "restore"):
+		s.restoreSiteDeploy(w, segments[1], segments[3])
+	case r.Method == http.MethodGet && match(segments, "deploys", "*", "files"):
+		s.listDeployFiles(w, r, segments[1])
+	case r.Method == http.MethodPut && len(segments) >= 4 && match(segments[:3], "deploys", "*", "files"):
+		s.uploadDeployFile(w, r, segments[1], path.Join(segments[3:]...))
+	case r.Method == http.MethodPost && match(segments, "deploys", "*", "cancel"):
+		s.cancelDeploy(w, segments[1])
+	case r.Method == http.MethodDelete && match(segments, "deploys", "*"):
+		s.deleteDeploy(w, segments[1])
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func match(segments []string, pattern ...string) bool {
+	if len(segments) != len(pattern) {
+		return false
+	}
+
+	for i, p := range pattern {
+		if p != "*" && p != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &models.Error{Code: int64(status), Message: message})
+}
+
+func paginate[T any](r *http.Request, items []T) []T {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+
+	if page < 1 {
+		page = 1
+	}
+
+	if perPage < 1 {
+		perPage = 100
+	}
+
+	start := (page - 1) * perPage
+	if start >= len(items) {
+		return []T{}
+	}
+
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return items[start:end]
+}
+
+func (s *Server) listSites(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	sites := []*models.Site{}
+	for _, site := range s.sites {
+		if strings.Contains(site.Name, name) {
+			sites = append(sites, site)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, paginate(r, sites))
+}
+
+func (s *Server) getSite(w http.ResponseWriter, siteID string) {
+	site := s.findSite(siteID)
+	if site == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, site)
+}
+
+func (s *Server) listDeployFiles(w http.ResponseWriter, r *http.Request, deployID string) {
+	d := s.findDeploy(deployID)
+	if d == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	files := s.fileModels(d)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	writeJSON(w, http.StatusOK, paginate(r, files))
+}
+
+func (s *Server) fileModels(d *deploy) (files []*models.File) {
+	files = []*models.File{}
+	if d == nil {
+		return
+	}
+
+	for p, sha := range d.files {
+		files = append(files, &models.File{
+			ID:   p,
+			Path: p,
+			Sha:  sha,
+			Size: int64(len(s.blobs[sha])),
+		})
+	}
+
+	return
+}
+
+func (s *Server) listSiteDeploys(w http.ResponseWriter, r *http.Request, siteID string) {
+	if s.findSite(siteID) == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	branch := r.URL.Query().Get("branch")
+
+	// Deploys are listed newest first.
+	deploys := []*models.Deploy{}
+	for i := len(s.deploys) - 1; i >= 0; i-- {
+		d := s.deploys[i].model
+		if d.SiteID == siteID && (branch == "" || d.Branch == branch) {
+			deploys = append(deploys, d)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, paginate(r, deploys))
+}
+
+type deployFiles struct {
+	Branch    string            `json:"branch"`
+	Draft     bool              `json:"draft"`
+	Files     map[string]string `json:"files"`
+	Functions map[string]string `json:"functions"`
+	CommitRef string            `json:"commit_ref"`
+	CommitURL string            `json:"commit_url"`
+}
+
+// deployResponse adds the fields describing functions, which are not part of models.Deploy.
+type deployResponse struct {
+	*models.Deploy
+	AvailableFunctions   []availableFunction `json:"available_functions"`
+	EdgeFunctionsPresent bool                `json:"edge_functions_present"`
+}
+
+type availableFunction struct {
+	Name   string `json:"n"`
+	Digest string `json:"d"`
+}
+
+func (d *deploy) response() *deployResponse {
+	response := &deployResponse{
+		Deploy:               d.model,
+		AvailableFunctions:   []availableFunction{},
+		EdgeFunctionsPresent: d.edgeFunctions,
+	}
+
+	for name, digest := range d.functions {
+		response.AvailableFunctions = append(response.AvailableFunctions, availableFunction{
+			Name:   name,
+			Digest: digest,
+		})
+	}
+
+	return response
+}
+
+func (s *Server) createSiteDeploy(w http.ResponseWriter, r *http.Request, siteID string) {
+	site := s.findSite(siteID)
+	if site == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	var body deployFiles
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	d := &deploy{
+		model: &models.Deploy{
+			ID:        s.newID(),
+			SiteID:    siteID,
+			Branch:    body.Branch,
+			Draft:     body.Draft,
+			Title:     r.URL.Query().Get("title"),
+			CommitRef: body.CommitRef,
+			CommitURL: body.CommitURL,
+			Required:  []string{},
+
+			RequiredFunctions: []string{},
+		},
+		files:     map[string]string{},
+		functions: body.Functions,
+	}
+
+	for _, digest := range body.Functions {
+		if !s.digests[digest] {
+			d.model.RequiredFunctions = append(d.model.RequiredFunctions, digest)
+		}
+	}
+
+	d.model.DeployURL = fmt.Sprintf("http://%s--%s.netlify.app", d.model.ID, site.Name)
+	d.model.DeploySslURL = fmt.Sprintf("https://%s--%s.netlify.app", d.model.ID, site.Name)
+
+	seen := map[string]bool{}
+	for p, sha := range body.Files {
+		d.files[p] = sha
+
+		if _, ok := s.blobs[sha]; !ok && !seen[sha] {
+			d.model.Required = append(d.model.Required, sha)
+			seen[sha] = true
+		}
+	}
+
+	if len(d.model.Required) > 0 || len(d.model.RequiredFunctions) > 0 {
+		d.model.State = "prepared"
+	} else {
+		d.model.State = "processing"
+	}
+
+	s.deploys = append(s.deploys, d)
+	writeJSON(w, http.StatusOK, d.response())
+}
+
+func (s *Server) getSiteDeploy(w http.ResponseWriter, siteID, deployID string) {
+	d := s.findDeploy(deployID)
+	if d == nil || d.model.SiteID != siteID {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	if d.model.State == "processing" {
+		if d.polls >= s.ProcessingPolls {
+			d.model.State = "ready"
+			s.publish(d)
+		} else {
+			d.polls++
+		}
+	}
+
+	writeJSON(w, http.StatusOK, d.response())
+}
+
+func (s *Server) restoreSiteDeploy(w http.ResponseWriter, siteID, deployID string) {
+	d := s.findDeploy(deployID)
+	if d == nil || d.model.SiteID != siteID {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	if d.model.State != "ready" {
+		writeError(w, http.StatusUnprocessableEntity, "Deploy is not ready")
+		return
+	}
+
+	s.publish(d)
+	writeJSON(w, http.StatusCreated, d.model)
+}
+
+func (s *Server) uploadDeployFile(w http.ResponseWriter, r *http.Request, deployID, filePath string) {
+	d := s.findDeploy(deployID)
+	if d == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	if d.model.State != "prepared" && d.model.State != "uploading" {
+		writeError(w, http.StatusUnprocessableEntity, "Deploy is not accepting uploads")
+		return
+	}
+
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sha := s.storeBlob(content)
+
+	required := d.model.Required[:0]
+	for _, r := range d.model.Required {
+		if r != sha {
+			required = append(required, r)
+		}
+	}
+
+	d.model.Required = required
+	if len(d.model.Required) == 0 && len(d.model.RequiredFunctions) == 0 {
+		d.model.State = "processing"
+	} else {
+		d.model.State = "uploading"
+	}
+
+	filePath = "/" + strings.TrimPrefix(filePath, "/")
+	writeJSON(w, http.StatusOK, &models.File{
+		ID:   filePath,
+		Path: filePath,
+		Sha:  sha,
+		Size: int64(len(content)),
+	})
+}
+
+func (s *Server) cancelDeploy(w http.ResponseWriter, deployID string) {
+	d := s.findDeploy(deployID)
+	if d == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	d.model.State = "error"
+	d.model.ErrorMessage = "Canceled build"
+
+	writeJSON(w, http.StatusCreated, d.model)
+}
+
+func (s *Server) deleteDeploy(w http.ResponseWriter, deployID string) {
+	for i, d := range s.deploys {
+		if d.model.ID == deployID {
+			s.deploys = append(s.deploys[:i], s.deploys[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Not Found")
+}
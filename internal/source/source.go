@@ -0,0 +1,297 @@
+package source
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Options controls how source entries are expanded into files.
+type Options struct {
+	// FollowSymlinks causes symbolic links inside a directory to be resolved. When false, links
+	// found while walking a directory are skipped.
+	FollowSymlinks bool
+
+	// ExcludeHidden skips files and directories whose name starts with a dot.
+	ExcludeHidden bool
+}
+
+// File maps a local file to its destination path on the site.
+type File struct {
+	Source      string
+	Destination string
+}
+
+// Resolve expands a single source entry into the list of files it refers to. If source is a regular
+// file it is mapped directly to destination. If it is a directory, it is walked recursively and each
+// file is mapped under destination, preserving its path relative to source. If source is a glob
+// pattern, see Glob.
+func Resolve(source, destination string, options Options) (files []File, err error) {
+	if IsGlob(source) {
+		return Glob(source, destination, options)
+	}
+
+	var info fs.FileInfo
+	info, err = os.Stat(source)
+	if err != nil {
+		return
+	}
+
+	if !info.IsDir() {
+		files = []File{{Source: source, Destination: destination}}
+		return
+	}
+
+	w := walker{
+		options: options,
+		visited: map[string]bool{},
+	}
+
+	files, err = w.walkSorted(source, destination)
+	return
+}
+
+// IsPattern reports whether source contains any glob metacharacters.
+func IsPattern(source string) bool {
+	return strings.ContainsAny(source, "*?[")
+}
+
+// IsGlob reports whether Resolve expands source as a glob pattern. Sources that contain metacharacters
+// but name an existing file or directory, such as "out/[slug].html", are used as they are.
+func IsGlob(source string) bool {
+	if !IsPattern(source) {
+		return false
+	}
+
+	_, err := os.Stat(source)
+	return err != nil
+}
+
+// Glob expands a pattern into the files it matches. Patterns use forward slashes and the syntax of
+// path.Match, with the addition of "**" which matches zero or more directories. Each match is mapped
+// under destination using its path relative to the longest leading part of the pattern that does not
+// contain any metacharacters. For example, "dist/**/*.pdf" maps "dist/v1/guide.pdf" to
+// destination + "/v1/guide.pdf".
+func Glob(pattern, destination string, options Options) (files []File, err error) {
+	root, segments := splitPattern(pattern)
+
+	// Validate the pattern up front so that syntax errors are not mistaken for a lack of matches.
+	for _, segment := range segments {
+		if _, err = path.Match(segment, ""); err != nil {
+			err = fmt.Errorf("invalid pattern %s: %w", pattern, err)
+			return
+		}
+	}
+
+	// Only walk into directories that files matching the pattern could be in. Without this, a pattern
+	// like "*.pdf" would walk every directory of the repository, including .git and node_modules.
+	w := walker{
+		options: options,
+		visited: map[string]bool{},
+		descend: func(dir string) bool {
+			return matchDirectory(segments, strings.Split(dir, "/"))
+		},
+	}
+
+	var candidates []File
+	candidates, err = w.walkSorted(filepath.FromSlash(root), "")
+	if err != nil {
+		return
+	}
+
+	for _, candidate := range candidates {
+		if matchSegments(segments, strings.Split(candidate.Destination, "/")) {
+			files = append(files, File{
+				Source:      candidate.Source,
+				Destination: path.Join(destination, candidate.Destination),
+			})
+		}
+	}
+
+	if len(files) == 0 {
+		err = fmt.Errorf("pattern %s did not match any files", pattern)
+	}
+
+	return
+}
+
+// splitPattern splits a pattern into the directory to walk, which is its longest leading part without
+// metacharacters, and the segments that are matched against paths relative to that directory.
+func splitPattern(pattern string) (root string, segments []string) {
+	segments = strings.Split(path.Clean(filepath.ToSlash(pattern)), "/")
+
+	var base []string
+	for len(segments) > 0 && !IsPattern(segments[0]) {
+		base = append(base, segments[0])
+		segments = segments[1:]
+	}
+
+	root = strings.Join(base, "/")
+	switch {
+	case len(base) == 1 && base[0] == "":
+		root = "/"
+	case root == "":
+		root = "."
+	}
+
+	return
+}
+
+// MatchRelative reports whether Glob could map a file matching the pattern to name, given relative to
+// the destination. For example, "dist/**/*.pdf" matches "v1/guide.pdf" but not "v1/index.html".
+func MatchRelative(pattern, name string) bool {
+	_, segments := splitPattern(pattern)
+	return matchSegments(segments, strings.Split(strings.TrimPrefix(name, "/"), "/"))
+}
+
+// Match reports whether name matches the pattern using the same syntax as Glob. Leading slashes on
+// either argument are ignored.
+func Match(pattern, name string) bool {
+	return matchSegments(
+		strings.Split(strings.TrimPrefix(pattern, "/"), "/"),
+		strings.Split(strings.TrimPrefix(name, "/"), "/"),
+	)
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try to match the rest of the pattern against every possible suffix of the name.
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// matchDirectory reports whether files inside of the directory could match the pattern.
+func matchDirectory(pattern, dir []string) bool {
+	for len(dir) > 0 {
+		if len(pattern) > 0 && pattern[0] == "**" {
+			return true
+		}
+
+		// The last segment of the pattern matches the file name, which cannot be a directory.
+		if len(pattern) < 2 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], dir[0]); !ok {
+			return false
+		}
+
+		pattern, dir = pattern[1:], dir[1:]
+	}
+
+	return true
+}
+
+type walker struct {
+	options Options
+	visited map[string]bool
+	files   []File
+
+	// descend, if set, decides whether to walk into a directory given its path relative to the root
+	// of the walk.
+	descend func(dir string) bool
+}
+
+func (w *walker) walkSorted(dir, prefix string) (files []File, err error) {
+	err = w.walk(dir, prefix)
+	if err != nil {
+		return
+	}
+
+	sort.Slice(w.files, func(i, j int) bool {
+		return w.files[i].Destination < w.files[j].Destination
+	})
+
+	files = w.files
+	return
+}
+
+func (w *walker) walk(dir, prefix string) (err error) {
+	// Track the real path of every directory currently being walked to avoid walking in circles
+	// through symlinks that point back to one of their parents.
+	var real string
+	real, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return
+	}
+
+	if w.visited[real] {
+		return
+	}
+
+	w.visited[real] = true
+	defer delete(w.visited, real)
+
+	var entries []fs.DirEntry
+	entries, err = os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if w.options.ExcludeHidden && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		var (
+			source      = filepath.Join(dir, entry.Name())
+			destination = path.Join(prefix, entry.Name())
+			mode        = entry.Type()
+		)
+
+		if mode&fs.ModeSymlink != 0 {
+			if !w.options.FollowSymlinks {
+				continue
+			}
+
+			var info fs.FileInfo
+			info, err = os.Stat(source)
+			if err != nil {
+				err = fmt.Errorf("could not resolve symlink %s: %w", source, err)
+				return
+			}
+
+			mode = info.Mode().Type()
+		}
+
+		switch {
+		case mode.IsDir():
+			if w.descend != nil && !w.descend(destination) {
+				continue
+			}
+
+			err = w.walk(source, destination)
+			if err != nil {
+				return
+			}
+		case mode.IsRegular():
+			w.files = append(w.files, File{Source: source, Destination: destination})
+		}
+	}
+
+	return
+}
@@ -0,0 +1,279 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func createTree(t *testing.T, paths ...string) (root string) {
+	t.Helper()
+
+	root = t.TempDir()
+	for _, p := range paths {
+		full := filepath.Join(root, filepath.FromSlash(p))
+
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(full, []byte(p), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return
+}
+
+func Test_Resolve(t *testing.T) {
+	root := createTree(t, "index.html", "css/site.css", ".hidden/secret.txt", "js/.map")
+
+	if err := os.Symlink(filepath.Join(root, "css"), filepath.Join(root, "styles")); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		source  string
+		options Options
+		result  []File
+	}{
+		{
+			name:   "single_file",
+			source: filepath.Join(root, "index.html"),
+			result: []File{
+				{Source: filepath.Join(root, "index.html"), Destination: "/dest"},
+			},
+		},
+		{
+			name:   "directory",
+			source: root,
+			result: []File{
+				{Source: filepath.Join(root, ".hidden", "secret.txt"), Destination: "/dest/.hidden/secret.txt"},
+				{Source: filepath.Join(root, "css", "site.css"), Destination: "/dest/css/site.css"},
+				{Source: filepath.Join(root, "index.html"), Destination: "/dest/index.html"},
+				{Source: filepath.Join(root, "js", ".map"), Destination: "/dest/js/.map"},
+			},
+		},
+		{
+			name:    "exclude_hidden",
+			source:  root,
+			options: Options{ExcludeHidden: true},
+			result: []File{
+				{Source: filepath.Join(root, "css", "site.css"), Destination: "/dest/css/site.css"},
+				{Source: filepath.Join(root, "index.html"), Destination: "/dest/index.html"},
+			},
+		},
+		{
+			name:    "follow_symlinks",
+			source:  root,
+			options: Options{FollowSymlinks: true, ExcludeHidden: true},
+			result: []File{
+				{Source: filepath.Join(root, "css", "site.css"), Destination: "/dest/css/site.css"},
+				{Source: filepath.Join(root, "index.html"), Destination: "/dest/index.html"},
+				{Source: filepath.Join(root, "styles", "site.css"), Destination: "/dest/styles/site.css"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Resolve(tc.source, "/dest", tc.options)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, result); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_Resolve_LiteralPattern(t *testing.T) {
+	root := createTree(t, "out/[slug].html", "out/about.html")
+
+	testCases := []struct {
+		name   string
+		source string
+		result []File
+	}{
+		{
+			name:   "existing_file",
+			source: filepath.Join(root, "out", "[slug].html"),
+			result: []File{
+				{Source: filepath.Join(root, "out", "[slug].html"), Destination: "/dest"},
+			},
+		},
+		{
+			name:   "pattern",
+			source: filepath.Join(root, "out", "[a-z]*.html"),
+			result: []File{
+				{Source: filepath.Join(root, "out", "about.html"), Destination: "/dest/about.html"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Resolve(tc.source, "/dest", Options{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(tc.result, result); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_Glob(t *testing.T) {
+	root := createTree(
+		t, "dist/guide-1.0.pdf", "dist/v1/api-2023.pdf", "dist/v1/deep/notes.pdf", "dist/readme.md",
+	)
+
+	testCases := []struct {
+		name    string
+		pattern string
+		result  []File
+	}{
+		{
+			name:    "single_level",
+			pattern: "dist/*.pdf",
+			result: []File{
+				{Source: filepath.Join(root, "dist", "guide-1.0.pdf"), Destination: "/docs/guide-1.0.pdf"},
+			},
+		},
+		{
+			name:    "double_star",
+			pattern: "dist/**/*.pdf",
+			result: []File{
+				{Source: filepath.Join(root, "dist", "guide-1.0.pdf"), Destination: "/docs/guide-1.0.pdf"},
+				{Source: filepath.Join(root, "dist", "v1", "api-2023.pdf"), Destination: "/docs/v1/api-2023.pdf"},
+				{Source: filepath.Join(root, "dist", "v1", "deep", "notes.pdf"), Destination: "/docs/v1/deep/notes.pdf"},
+			},
+		},
+		{
+			name:    "wildcard_directory",
+			pattern: "d*/v1/*",
+			result: []File{
+				{Source: filepath.Join(root, "dist", "v1", "api-2023.pdf"), Destination: "/docs/dist/v1/api-2023.pdf"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Resolve(filepath.ToSlash(root)+"/"+tc.pattern, "/docs", Options{})
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, result); diff != "" {
+				t.Errorf("Value mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_Glob_NoMatches(t *testing.T) {
+	root := createTree(t, "dist/readme.md")
+
+	_, err := Glob(filepath.ToSlash(root)+"/dist/*.pdf", "/docs", Options{})
+	if err == nil {
+		t.Error("Expected an error when the pattern matches nothing")
+	}
+}
+
+func Test_Glob_OnlyWalksMatchingDirectories(t *testing.T) {
+	root := createTree(t, "report.pdf", "node_modules/pkg/index.js", ".git/HEAD")
+
+	// Walking into node_modules would fail on the broken symlink.
+	if err := os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "node_modules", "pkg", "broken")); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Glob(filepath.ToSlash(root)+"/*.pdf", "/docs", Options{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []File{{Source: filepath.Join(root, "report.pdf"), Destination: "/docs/report.pdf"}}
+	if diff := cmp.Diff(expected, result); diff != "" {
+		t.Errorf("Value mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_matchDirectory(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		dir     string
+		result  bool
+	}{
+		{pattern: "*.pdf", dir: "node_modules", result: false},
+		{pattern: "*/*.pdf", dir: "v1", result: true},
+		{pattern: "*/*.pdf", dir: "v1/deep", result: false},
+		{pattern: "v*/*.pdf", dir: "dist", result: false},
+		{pattern: "**/*.pdf", dir: "v1/deep/deeper", result: true},
+		{pattern: "v1/**", dir: "v1/deep", result: true},
+		{pattern: "v1/**", dir: "v2/deep", result: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+"_"+tc.dir, func(t *testing.T) {
+			result := matchDirectory(strings.Split(tc.pattern, "/"), strings.Split(tc.dir, "/"))
+			if result != tc.result {
+				t.Errorf("matchDirectory(%q, %q) = %t, want %t", tc.pattern, tc.dir, result, tc.result)
+			}
+		})
+	}
+}
+
+func Test_MatchRelative(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		result  bool
+	}{
+		{pattern: "reports/*.pdf", name: "old.pdf", result: true},
+		{pattern: "reports/*.pdf", name: "index.html", result: false},
+		{pattern: "reports/*.pdf", name: "archive/old.pdf", result: false},
+		{pattern: "dist/**/*.pdf", name: "/v1/guide.pdf", result: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+"_"+tc.name, func(t *testing.T) {
+			if result := MatchRelative(tc.pattern, tc.name); result != tc.result {
+				t.Errorf("MatchRelative(%q, %q) = %t, want %t", tc.pattern, tc.name, result, tc.result)
+			}
+		})
+	}
+}
+
+func Test_Match(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		result  bool
+	}{
+		{pattern: "/docs/*.pdf", name: "/docs/guide.pdf", result: true},
+		{pattern: "docs/*.pdf", name: "/docs/v1/guide.pdf", result: false},
+		{pattern: "/docs/**", name: "/docs/v1/guide.pdf", result: true},
+		{pattern: "/docs/**/*.pdf", name: "/docs/guide.pdf", result: true},
+		{pattern: "/docs/**/*.pdf", name: "/other/guide.pdf", result: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+"_"+tc.name, func(t *testing.T) {
+			if result := Match(tc.pattern, tc.name); result != tc.result {
+				t.Errorf("Match(%q, %q) = %t, want %t", tc.pattern, tc.name, result, tc.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package upload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/strfmt"
+	"github.com/netlify/open-api/v2/go/models"
+	"github.com/netlify/open-api/v2/go/plumbing"
+	"github.com/netlify/open-api/v2/go/plumbing/operations"
+)
+
+// NetlifyClient is the subset of the Netlify API operations used by Handler, along with operations
+// the generated client does not support.
+type NetlifyClient interface {
+	ListSites(params *operations.ListSitesParams, authInfo runtime.ClientAuthInfoWriter) (*operations.ListSitesOK, error)
+	GetSite(params *operations.GetSiteParams, authInfo runtime.ClientAuthInfoWriter) (*operations.GetSiteOK, error)
+	ListSiteDeploys(params *operations.ListSiteDeploysParams, authInfo runtime.ClientAuthInfoWriter) (*operations.ListSiteDeploysOK, error)
+	GetSiteDeploy(params *operations.GetSiteDeployParams, authInfo runtime.ClientAuthInfoWriter) (*operations.GetSiteDeployOK, error)
+	UploadDeployFile(params *operations.UploadDeployFileParams, authInfo runtime.ClientAuthInfoWriter) (*operations.UploadDeployFileOK, error)
+	RestoreSiteDeploy(params *operations.RestoreSiteDeployParams, authInfo runtime.ClientAuthInfoWriter) (*operations.RestoreSiteDeployCreated, error)
+	CancelSiteDeploy(params *operations.CancelSiteDeployParams, authInfo runtime.ClientAuthInfoWriter) (*operations.CancelSiteDeployCreated, error)
+	DeleteDeploy(params *operations.DeleteDeployParams, authInfo runtime.ClientAuthInfoWriter) (*operations.DeleteDeployNoContent, error)
+
+	// GetDeployFunctions returns the functions of a deploy, which are not part of models.Deploy.
+	GetDeployFunctions(params *operations.GetSiteDeployParams, authInfo runtime.ClientAuthInfoWriter) (*DeployFunctions, error)
+
+	// ListDeployFiles returns a page of the files that make up a deploy.
+	ListDeployFiles(params *ListDeployFilesParams, authInfo runtime.ClientAuthInfoWriter) ([]*models.File, error)
+
+	// CreateDeploy creates a deploy, including the commit fields that models.DeployFiles is missing.
+	CreateDeploy(params *CreateDeployParams, authInfo runtime.ClientAuthInfoWriter) (*models.Deploy, error)
+}
+
+// CreateDeployParams contains the parameters of the CreateDeploy operation.
+type CreateDeployParams struct {
+	SiteID string
+	Title  string
+	Deploy *DeployFiles
+
+	Context    context.Context
+	HTTPClient *http.Client
+}
+
+// DeployFiles is the body of a new deploy.
+type DeployFiles struct {
+	models.DeployFiles
+
+	// CommitRef is the commit the deploy was built from.
+	CommitRef string `json:"commit_ref,omitempty"`
+
+	// CommitURL is shown as the link of the commit in the Netlify UI.
+	CommitURL string `json:"commit_url,omitempty"`
+}
+
+// WriteToRequest writes the parameters to a request.
+func (p *CreateDeployParams) WriteToRequest(r runtime.ClientRequest, _ strfmt.Registry) (err error) {
+	if err = r.SetPathParam("site_id", p.SiteID); err != nil {
+		return
+	}
+
+	if p.Title != "" {
+		if err = r.SetQueryParam("title", p.Title); err != nil {
+			return
+		}
+	}
+
+	err = r.SetBodyParam(p.Deploy)
+	return
+}
+
+// ListDeployFilesParams contains the parameters of the ListDeployFiles operation.
+type ListDeployFilesParams struct {
+	DeployID string
+	Page     int32
+	PerPage  int32
+
+	Context    context.Context
+	HTTPClient *http.Client
+}
+
+// WriteToRequest writes the parameters to a request.
+func (p *ListDeployFilesParams) WriteToRequest(r runtime.ClientRequest, _ strfmt.Registry) (err error) {
+	if err = r.SetPathParam("deploy_id", p.DeployID); err != nil {
+		return
+	}
+
+	if p.Page > 0 {
+		if err = r.SetQueryParam("page", strconv.Itoa(int(p.Page))); err != nil {
+			return
+		}
+	}
+
+	if p.PerPage > 0 {
+		err = r.SetQueryParam("per_page", strconv.Itoa(int(p.PerPage)))
+	}
+
+	return
+}
+
+// DeployFunctions describes the serverless and edge functions that are part of a deploy.
+type DeployFunctions struct {
+	Functions            []DeployFunction `json:"available_functions"`
+	EdgeFunctionsPresent bool             `json:"edge_functions_present"`
+}
+
+// DeployFunction is a serverless function in a deploy, identified by its name and SHA256 digest.
+type DeployFunction struct {
+	Name   string `json:"n"`
+	Digest string `json:"d"`
+}
+
+// NewClient creates a NetlifyClient that sends requests through the given transport. Failed responses
+// are annotated with their status code so that they can be retried.
+func NewClient(transport runtime.ClientTransport) NetlifyClient {
+	transport = statusTransport{transport}
+
+	return &netlifyClient{
+		ClientService: plumbing.New(transport, nil).Operations,
+		transport:     transport,
+	}
+}
+
+// netlifyClient adds the operations that are missing from the generated client.
+type netlifyClient struct {
+	operations.ClientService
+	transport runtime.ClientTransport
+}
+
+func (c *netlifyClient) GetDeployFunctions(params *operations.GetSiteDeployParams, authInfo runtime.ClientAuthInfoWriter) (functions *DeployFunctions, err error) {
+	functions = new(DeployFunctions)
+	err = c.submit(&runtime.ClientOperation{
+		ID:          "getSiteDeployFunctions",
+		Method:      http.MethodGet,
+		PathPattern: "/sites/{site_id}/deploys/{deploy_id}",
+		Params:      params,
+		AuthInfo:    authInfo,
+		Context:     params.Context,
+		Client:      params.HTTPClient,
+	}, functions)
+
+	if err != nil {
+		functions = nil
+	}
+
+	return
+}
+
+func (c *netlifyClient) ListDeployFiles(params *ListDeployFilesParams, authInfo runtime.ClientAuthInfoWriter) (files []*models.File, err error) {
+	err = c.submit(&runtime.ClientOperation{
+		ID:          "listDeployFiles",
+		Method:      http.MethodGet,
+		PathPattern: "/deploys/{deploy_id}/files",
+		Params:      params,
+		AuthInfo:    authInfo,
+		Context:     params.Context,
+		Client:      params.HTTPClient,
+	}, &files)
+
+	return
+}
+
+func (c *netlifyClient) CreateDeploy(params *CreateDeployParams, authInfo runtime.ClientAuthInfoWriter) (deploy *models.Deploy, err error) {
+	deploy = new(models.Deploy)
+	err = c.submit(&runtime.ClientOperation{
+		ID:          "createSiteDeploy",
+		Method:      http.MethodPost,
+		PathPattern: "/sites/{site_id}/deploys",
+		Params:      params,
+		AuthInfo:    authInfo,
+		Context:     params.Context,
+		Client:      params.HTTPClient,
+	}, deploy)
+
+	if err != nil {
+		deploy = nil
+	}
+
+	return
+}
+
+// submit sends a JSON operation and decodes a successful response into result.
+func (c *netlifyClient) submit(op *runtime.ClientOperation, result interface{}) (err error) {
+	op.ProducesMediaTypes = []string{runtime.JSONMime}
+	op.ConsumesMediaTypes = []string{runtime.JSONMime}
+	op.Schemes = []string{"https"}
+	op.Reader = jsonReader{operation: op.ID, result: result}
+
+	_, err = c.transport.Submit(op)
+	return
+}
+
+type jsonReader struct {
+	operation string
+	result    interface{}
+}
+
+func (r jsonReader) ReadResponse(response runtime.ClientResponse, consumer runtime.Consumer) (interface{}, error) {
+	if response.Code()/100 != 2 {
+		payload := new(models.Error)
+		if err := consumer.Consume(response.Body(), payload); err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		return nil, runtime.NewAPIError(r.operation, payload, response.Code())
+	}
+
+	if err := consumer.Consume(response.Body(), r.result); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return r.result, nil
+}
+
+// defaultClient talks to the public Netlify API.
+var defaultClient = NewClient(
+	client.New(plumbing.DefaultHost, plumbing.DefaultBasePath, plumbing.DefaultSchemes),
+)
+
+// ClientOptions configures how a NetlifyClient connects to the Netlify API. Zero values fall back to
+// the defaults of the public API and the standard library.
+type ClientOptions struct {
+	Host     string
+	BasePath string
+	Scheme   string
+
+	// Timeout limits the duration of every request, including uploads.
+	Timeout time.Duration
+
+	// Proxy is the URL of an HTTP proxy. If empty, the usual proxy environment variables are used.
+	Proxy string
+
+	// CABundle is the path to a PEM file with certificates that are trusted in addition to the system
+	// certificate pool.
+	CABundle string
+
+	// UserAgent is sent with every request.
+	UserAgent string
+}
+
+// NewClientWithOptions creates a NetlifyClient with its own HTTP transport.
+func NewClientWithOptions(options ClientOptions) (c NetlifyClient, err error) {
+	var (
+		host     = plumbing.DefaultHost
+		basePath = plumbing.DefaultBasePath
+		schemes  = plumbing.DefaultSchemes
+	)
+
+	if options.Host != "" {
+		host = options.Host
+	}
+
+	if options.BasePath != "" {
+		basePath = options.BasePath
+	}
+
+	if options.Scheme != "" {
+		schemes = []string{options.Scheme}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if options.Proxy != "" {
+		var proxy *url.URL
+		proxy, err = url.Parse(options.Proxy)
+		if err != nil {
+			err = fmt.Errorf("invalid proxy URL %s: %w", options.Proxy, err)
+			return
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if options.CABundle != "" {
+		var pool *x509.CertPool
+		pool, err = loadCertPool(options.CABundle)
+		if err != nil {
+			return
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	httpClient := &http.Client{
+		Timeout:   options.Timeout,
+		Transport: userAgentTransport{userAgent: options.UserAgent, next: transport},
+	}
+
+	c = NewClient(client.NewWithClient(host, basePath, schemes, httpClient))
+	return
+}
+
+func loadCertPool(path string) (pool *x509.CertPool, err error) {
+	pool, err = x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	var pem []byte
+	pem, err = os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("could not read CA bundle: %w", err)
+		return
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		err = fmt.Errorf("CA bundle %s does not contain any PEM encoded certificates", path)
+	}
+
+	return
+}
+
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.userAgent != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,60 @@
+package upload
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/netlify/open-api/v2/go/plumbing/operations"
+)
+
+func Test_NewClientWithOptions(t *testing.T) {
+	var userAgent, path string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, path = r.UserAgent(), r.URL.Path
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "1234", "name": "docs"}`))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+
+	c, err := NewClientWithOptions(ClientOptions{
+		Host:      u.Host,
+		BasePath:  "/gateway/netlify",
+		Scheme:    u.Scheme,
+		UserAgent: "upload-to-netlify-action/1.0.0",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	result, err := c.GetSite(operations.NewGetSiteParams().WithSiteID("1234"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff("docs", result.GetPayload().Name); diff != "" {
+		t.Errorf("Site mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("/gateway/netlify/sites/1234", path); diff != "" {
+		t.Errorf("Path mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("upload-to-netlify-action/1.0.0", userAgent); diff != "" {
+		t.Errorf("User-Agent mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_NewClientWithOptions_InvalidCABundle(t *testing.T) {
+	_, err := NewClientWithOptions(ClientOptions{CABundle: "testdata/does-not-exist.pem"})
+	if err == nil {
+		t.Error("Expected an error for a missing CA bundle")
+	}
+}
@@ -0,0 +1,225 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/runtime/client"
+	"github.com/netlify/open-api/v2/go/models"
+	"github.com/netlify/open-api/v2/go/plumbing/operations"
+)
+
+// PollPolicy describes how the state of a deploy is polled while waiting on it.
+type PollPolicy struct {
+	// Timeout limits how long to wait for a deploy. Zero means no limit.
+	Timeout time.Duration
+
+	// Interval is the delay before the first poll. It doubles after every poll that does not change
+	// the state of the deploy, and is reset whenever the state changes.
+	Interval time.Duration
+
+	// MaxInterval caps the delay between polls. Zero means no cap.
+	MaxInterval time.Duration
+
+	// Jitter is the fraction (0-1) of each delay that is randomized.
+	Jitter float64
+}
+
+// DefaultPollPolicy is used by handlers that do not specify their own policy.
+var DefaultPollPolicy = PollPolicy{
+	Timeout:     10 * time.Minute,
+	Interval:    2 * time.Second,
+	MaxInterval: 15 * time.Second,
+	Jitter:      0.2,
+}
+
+func (p PollPolicy) delay(polls int) (d time.Duration) {
+	d = p.Interval << polls
+	if p.MaxInterval > 0 && (d > p.MaxInterval || d <= 0) {
+		d = p.MaxInterval
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+
+	return
+}
+
+// DeployError is returned when a deploy enters the error state while it is being waited on.
+type DeployError struct {
+	DeployID string
+
+	// Message is the reason Netlify gave for the failure, if any.
+	Message string
+}
+
+func (e *DeployError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("deploy %s failed", e.DeployID)
+	}
+
+	return fmt.Sprintf("deploy %s failed: %s", e.DeployID, e.Message)
+}
+
+func (h Handler) poll() PollPolicy {
+	if h.Poll == (PollPolicy{}) {
+		return DefaultPollPolicy
+	}
+
+	return h.Poll
+}
+
+// pollUntil calls check with the delay of the poll policy before each call, until check is done or
+// fails. The delay backs off while check reports that nothing changed. describe names what is being
+// waited on for the error returned when ctx ends or the poll policy times out.
+func (h Handler) pollUntil(
+	ctx context.Context,
+	describe func() string,
+	check func(ctx context.Context) (done, changed bool, err error),
+) (err error) {
+	policy := h.poll()
+
+	pollCtx := ctx
+	if policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		pollCtx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+
+	for polls := 0; ; polls++ {
+		timer := time.NewTimer(policy.delay(polls))
+
+		select {
+		case <-pollCtx.Done():
+			timer.Stop()
+			err = h.stoppedWaiting(ctx, describe())
+			return
+		case <-timer.C:
+		}
+
+		var done, changed bool
+		done, changed, err = check(pollCtx)
+		if err != nil {
+			if pollCtx.Err() != nil {
+				err = h.stoppedWaiting(ctx, describe())
+			}
+
+			return
+		}
+
+		if done {
+			return
+		}
+
+		if changed {
+			polls = -1
+		}
+	}
+}
+
+// stoppedWaiting describes why waiting ended early. If ctx is still alive, the poll policy timed out.
+func (h Handler) stoppedWaiting(ctx context.Context, waitingFor string) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("stopped waiting for %s: %w", waitingFor, ctx.Err())
+	}
+
+	return fmt.Errorf("timed out after %s waiting for %s: %w", h.poll().Timeout, waitingFor, context.DeadlineExceeded)
+}
+
+func (h Handler) waitForState(ctx context.Context, deploy *models.Deploy, states ...string) (current *models.Deploy, err error) {
+	var previous string
+
+	describe := func() string {
+		state := previous
+		if state == "" {
+			state = "unknown"
+		}
+
+		return fmt.Sprintf("deploy %s to enter states [%s] while it was %s", deploy.ID, strings.Join(states, ", "), state)
+	}
+
+	err = h.pollUntil(ctx, describe, func(ctx context.Context) (done, changed bool, err error) {
+		params := &operations.GetSiteDeployParams{
+			Context:  h.createContext(ctx),
+			SiteID:   deploy.SiteID,
+			DeployID: deploy.ID,
+		}
+
+		var result *operations.GetSiteDeployOK
+		err = h.retry(ctx, func() (e error) {
+			result, e = h.api().GetSiteDeploy(params, client.BearerToken(h.Token))
+			return
+		})
+
+		if err != nil {
+			return
+		}
+
+		current = result.GetPayload()
+		if changed = current.State != previous; changed {
+			if h.StateChanged != nil {
+				h.StateChanged(current, previous)
+			}
+
+			previous = current.State
+		}
+
+		for _, state := range states {
+			if current.State == state {
+				done = true
+				return
+			}
+		}
+
+		if current.State == "error" {
+			err = &DeployError{DeployID: current.ID, Message: current.ErrorMessage}
+		}
+
+		return
+	})
+
+	if err != nil {
+		current = nil
+	}
+
+	return
+}
+
+// WaitForPublishedDeploy waits until the deploy with the given ID is the published deploy of the site,
+// which is how a restored deploy goes live. The site is returned once it is published.
+func (h Handler) WaitForPublishedDeploy(ctx context.Context, siteID, deployID string) (site *models.Site, err error) {
+	describe := func() string {
+		return fmt.Sprintf("deploy %s to be published", deployID)
+	}
+
+	err = h.pollUntil(ctx, describe, func(ctx context.Context) (done, changed bool, err error) {
+		params := &operations.GetSiteParams{
+			Context: h.createContext(ctx),
+			SiteID:  siteID,
+		}
+
+		var result *operations.GetSiteOK
+		err = h.retry(ctx, func() (e error) {
+			result, e = h.api().GetSite(params, client.BearerToken(h.Token))
+			return
+		})
+
+		if err != nil {
+			return
+		}
+
+		site = result.GetPayload()
+		done = site.PublishedDeploy != nil && site.PublishedDeploy.ID == deployID
+		return
+	})
+
+	if err != nil {
+		site = nil
+	}
+
+	return
+}
@@ -0,0 +1,196 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-openapi/runtime"
+)
+
+// RetryPolicy describes how failed Netlify API calls are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a call is attempted. Values less than one are
+	// treated as one.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. It doubles with every subsequent attempt.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the computed delay between attempts. Zero means no cap.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction (0-1) of each computed delay that is randomized.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used by handlers that do not specify their own policy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.2,
+}
+
+// StatusError wraps an error returned by the Netlify API along with the response status code and
+// any delay the server asked for before retrying.
+type StatusError struct {
+	Code       int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the request may succeed if tried again.
+func (e *StatusError) Temporary() bool {
+	switch e.Code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func isTemporary(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isSafeToResend reports whether a request that is not idempotent may be sent again after it failed
+// with err. That is only the case if Netlify rate limited it, or if it never reached Netlify because
+// the connection could not be established.
+func isSafeToResend(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusTooManyRequests
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (p RetryPolicy) delay(attempt int, err error) (d time.Duration) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		d = statusErr.RetryAfter
+		return
+	}
+
+	d = p.BaseDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d <= 0) {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+
+	return
+}
+
+// Do calls fn until it succeeds, returns a permanent error, or the policy runs out of attempts.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) (err error) {
+	return p.do(ctx, isTemporary, fn)
+}
+
+// do calls fn until it succeeds, returns an error that retryable rejects, or the policy runs out of
+// attempts.
+func (p RetryPolicy) do(ctx context.Context, retryable func(error) bool, fn func() error) (err error) {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !retryable(err) {
+			break
+		}
+
+		timer := time.NewTimer(p.delay(attempt, err))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = fmt.Errorf("%w (retry aborted: %s)", err, ctx.Err())
+			return
+		case <-timer.C:
+		}
+	}
+
+	return
+}
+
+// statusTransport records the status code and rate limit headers of failed responses so that
+// callers can decide whether and when to retry.
+type statusTransport struct {
+	runtime.ClientTransport
+}
+
+func (t statusTransport) Submit(op *runtime.ClientOperation) (interface{}, error) {
+	op.Reader = statusReader{op.Reader}
+	return t.ClientTransport.Submit(op)
+}
+
+type statusReader struct {
+	runtime.ClientResponseReader
+}
+
+func (r statusReader) ReadResponse(response runtime.ClientResponse, consumer runtime.Consumer) (result interface{}, err error) {
+	result, err = r.ClientResponseReader.ReadResponse(response, consumer)
+	if err != nil {
+		err = &StatusError{
+			Code:       response.Code(),
+			RetryAfter: retryAfter(response, time.Now()),
+			Err:        err,
+		}
+	}
+
+	return
+}
+
+func retryAfter(response runtime.ClientResponse, now time.Time) time.Duration {
+	if value := response.GetHeader("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+
+		if date, err := http.ParseTime(value); err == nil {
+			return date.Sub(now)
+		}
+	}
+
+	if value := response.GetHeader("X-RateLimit-Reset"); value != "" {
+		if reset, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(reset, 0).Sub(now)
+		}
+	}
+
+	return 0
+}
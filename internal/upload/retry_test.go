@@ -0,0 +1,267 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/netlify/open-api/v2/go/models"
+)
+
+func Test_RetryPolicy_Do(t *testing.T) {
+	var (
+		badGateway  = &StatusError{Code: http.StatusBadGateway, Err: errors.New("bad gateway")}
+		unavailable = &StatusError{Code: http.StatusServiceUnavailable, Err: errors.New("unavailable")}
+		forbidden   = &StatusError{Code: http.StatusForbidden, Err: errors.New("forbidden")}
+		connReset   = &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+
+		policy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	)
+
+	testCases := []struct {
+		name    string
+		errs    []error
+		calls   int
+		errored bool
+	}{
+		{name: "success", calls: 1},
+		{name: "temporary_errors", errs: []error{badGateway, unavailable}, calls: 3},
+		{name: "network_error", errs: []error{connReset}, calls: 2},
+		{name: "permanent_error", errs: []error{forbidden}, calls: 1, errored: true},
+		{name: "out_of_attempts", errs: []error{badGateway, badGateway, badGateway}, calls: 3, errored: true},
+		{name: "canceled", errs: []error{context.Canceled}, calls: 1, errored: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+
+			err := policy.Do(context.Background(), func() (e error) {
+				if calls < len(tc.errs) {
+					e = tc.errs[calls]
+				}
+
+				calls++
+				return
+			})
+
+			if tc.errored != (err != nil) {
+				t.Errorf("Expected error: %t, got: %v", tc.errored, err)
+			}
+
+			if diff := cmp.Diff(tc.calls, calls); diff != "" {
+				t.Errorf("Calls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_RetryPolicy_Do_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}
+	err := policy.Do(ctx, func() error {
+		calls++
+		return &StatusError{Code: http.StatusBadGateway, Err: errors.New("bad gateway")}
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "retry aborted") || calls != 1 {
+		t.Errorf("Expected a single call aborted by the context, got %d calls and error: %v", calls, err)
+	}
+}
+
+func Test_RetryPolicy_delay(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		err     error
+		result  time.Duration
+	}{
+		{
+			name:    "first_retry",
+			policy:  RetryPolicy{BaseDelay: time.Second},
+			attempt: 1,
+			result:  time.Second,
+		},
+		{
+			name:    "exponential",
+			policy:  RetryPolicy{BaseDelay: time.Second},
+			attempt: 3,
+			result:  4 * time.Second,
+		},
+		{
+			name:    "max_delay",
+			policy:  RetryPolicy{BaseDelay: time.Second, MaxDelay: 3 * time.Second},
+			attempt: 3,
+			result:  3 * time.Second,
+		},
+		{
+			name:    "max_delay_overflow",
+			policy:  RetryPolicy{BaseDelay: time.Second, MaxDelay: 3 * time.Second},
+			attempt: 70,
+			result:  3 * time.Second,
+		},
+		{
+			name:    "retry_after",
+			policy:  RetryPolicy{BaseDelay: time.Second, MaxDelay: 3 * time.Second},
+			attempt: 1,
+			err:     &StatusError{Code: http.StatusTooManyRequests, RetryAfter: 10 * time.Second},
+			result:  10 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.result, tc.policy.delay(tc.attempt, tc.err)); diff != "" {
+				t.Errorf("Delay mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_RetryPolicy_delay_Jitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		if d := policy.delay(1, nil); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("Expected a delay from 500ms to 1s, got %s", d)
+		}
+	}
+}
+
+type headerResponse http.Header
+
+func (r headerResponse) Code() int {
+	return http.StatusTooManyRequests
+}
+
+func (r headerResponse) Message() string {
+	return http.StatusText(http.StatusTooManyRequests)
+}
+
+func (r headerResponse) GetHeader(name string) string {
+	return http.Header(r).Get(name)
+}
+
+func (r headerResponse) Body() io.ReadCloser {
+	return http.NoBody
+}
+
+func Test_retryAfter(t *testing.T) {
+	now := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name   string
+		header http.Header
+		result time.Duration
+	}{
+		{
+			name:   "seconds",
+			header: http.Header{"Retry-After": {"120"}},
+			result: 2 * time.Minute,
+		},
+		{
+			name:   "http_date",
+			header: http.Header{"Retry-After": {now.Add(30 * time.Second).Format(http.TimeFormat)}},
+			result: 30 * time.Second,
+		},
+		{
+			name:   "rate_limit_reset",
+			header: http.Header{"X-Ratelimit-Reset": {strconv.FormatInt(now.Add(45*time.Second).Unix(), 10)}},
+			result: 45 * time.Second,
+		},
+		{
+			name: "retry_after_first",
+			header: http.Header{
+				"Retry-After":       {"5"},
+				"X-Ratelimit-Reset": {strconv.FormatInt(now.Add(45*time.Second).Unix(), 10)},
+			},
+			result: 5 * time.Second,
+		},
+		{
+			name:   "invalid",
+			header: http.Header{"Retry-After": {"soon"}},
+		},
+		{
+			name: "missing",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.result, retryAfter(headerResponse(tc.header), now)); diff != "" {
+				t.Errorf("Delay mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_isSafeToResend(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		result bool
+	}{
+		{name: "rate_limited", err: &StatusError{Code: http.StatusTooManyRequests}, result: true},
+		{name: "server_error", err: &StatusError{Code: http.StatusBadGateway}},
+		{name: "dial", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, result: true},
+		{name: "read", err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}},
+		{name: "canceled", err: &net.OpError{Op: "dial", Err: context.Canceled}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.result, isSafeToResend(tc.err)); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandler_CreateDeployWithFiles_Retry(t *testing.T) {
+	testCases := []struct {
+		name    string
+		status  int
+		creates int
+		errored bool
+	}{
+		{name: "rate_limited", status: http.StatusTooManyRequests, creates: 2},
+		{name: "server_error", status: http.StatusBadGateway, creates: 1, errored: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, server := newTestHandler(t)
+
+			site := server.AddSite(&models.Site{Name: "docs"})
+			server.FailRequests(http.MethodPost, "/sites/"+site.ID+"/deploys", 1, tc.status, nil)
+
+			_, err := handler.CreateDeployWithFiles(context.Background(), NewDeployWithExistingFiles(site.ID, "main", nil))
+			if tc.errored != (err != nil) {
+				t.Errorf("Expected error: %t, got: %v", tc.errored, err)
+			}
+
+			var creates int
+			for _, request := range server.Requests() {
+				if request == http.MethodPost+" /sites/"+site.ID+"/deploys" {
+					creates++
+				}
+			}
+
+			if diff := cmp.Diff(tc.creates, creates); diff != "" {
+				t.Errorf("Create requests mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
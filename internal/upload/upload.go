@@ -7,11 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/go-openapi/runtime/client"
+	"github.com/mrflynn/upload-to-netlify-action/internal/fuzzy"
 	"github.com/netlify/open-api/v2/go/models"
 	"github.com/netlify/open-api/v2/go/plumbing/operations"
-	"github.com/netlify/open-api/v2/go/porcelain"
 
 	netlify_context "github.com/netlify/open-api/v2/go/porcelain/context"
 )
@@ -19,6 +22,49 @@ import (
 // Handler provides high level functions to upload files to Netlify through their SDK.
 type Handler struct {
 	Token string
+
+	// Concurrency is the maximum number of files uploaded at once. Values less than one are
+	// treated as one.
+	Concurrency int
+
+	// Retry is the policy applied to every API call. The zero value uses DefaultRetryPolicy.
+	Retry RetryPolicy
+
+	// Client is used to make requests to Netlify. If nil, the public Netlify API is used.
+	Client NetlifyClient
+
+	// Poll is the policy used while waiting on deploys. The zero value uses DefaultPollPolicy.
+	Poll PollPolicy
+
+	// StateChanged is called, if set, whenever a deploy that is being waited on changes state. The
+	// previous state is empty for the first poll.
+	StateChanged func(deploy *models.Deploy, previous string)
+}
+
+func (h Handler) api() NetlifyClient {
+	if h.Client == nil {
+		return defaultClient
+	}
+
+	return h.Client
+}
+
+func (h Handler) retryPolicy() RetryPolicy {
+	if h.Retry == (RetryPolicy{}) {
+		return DefaultRetryPolicy
+	}
+
+	return h.Retry
+}
+
+func (h Handler) retry(ctx context.Context, fn func() error) error {
+	return h.retryPolicy().Do(ctx, fn)
+}
+
+// retryUnsent is like retry, but for requests that are not idempotent. Such requests are only retried
+// if Netlify could not have acted on them, so that a failed attempt cannot leave a duplicate behind.
+func (h Handler) retryUnsent(ctx context.Context, fn func() error) error {
+	return h.retryPolicy().do(ctx, isSafeToResend, fn)
 }
 
 func (h Handler) createContext(inner context.Context) (outer context.Context) {
@@ -26,46 +72,215 @@ func (h Handler) createContext(inner context.Context) (outer context.Context) {
 	return
 }
 
-// GetSite returns a model of the site using the given name if one exists.
-func (h Handler) GetSite(ctx context.Context, name string) (site *models.Site, err error) {
-	ctx = h.createContext(ctx)
+// GetSiteByID returns a model of the site with the given ID.
+func (h Handler) GetSiteByID(ctx context.Context, id string) (site *models.Site, err error) {
+	params := &operations.GetSiteParams{
+		Context: h.createContext(ctx),
+		SiteID:  id,
+	}
+
+	var result *operations.GetSiteOK
+	err = h.retry(ctx, func() (e error) {
+		result, e = h.api().GetSite(params, client.BearerToken(h.Token))
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	site = result.GetPayload()
+	return
+}
 
+// GetSite returns a model of the site whose name, custom domain, or domain alias equals name. If
+// accountSlug is not empty, only sites belonging to that account are considered.
+func (h Handler) GetSite(ctx context.Context, name, accountSlug string) (site *models.Site, err error) {
+	// Netlify filters sites by name on the server, so try that first before listing every site the
+	// token has access to.
 	var sites []*models.Site
-	sites, err = porcelain.Default.ListSites(ctx, &operations.ListSitesParams{Context: ctx, Name: &name})
+	sites, err = h.listSites(ctx, &name)
 	if err != nil {
 		return
 	}
 
-	for _, s := range sites {
-		if s.Name == name {
-			site = s
+	site, err = findSite(sites, name, accountSlug)
+	if site != nil || err != nil {
+		return
+	}
+
+	sites, err = h.listSites(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	site, err = findSite(sites, name, accountSlug)
+	if site != nil || err != nil {
+		return
+	}
+
+	err = fmt.Errorf("could not find site with name or domain %s", name)
+	if nearMatches := findSimilarSites(sites, name); len(nearMatches) > 0 {
+		err = fmt.Errorf("%w (similar sites: %s)", err, strings.Join(nearMatches, ", "))
+	}
+
+	return
+}
+
+const sitesPerPage = 100
+
+func (h Handler) listSites(ctx context.Context, name *string) (sites []*models.Site, err error) {
+	ctx = h.createContext(ctx)
+
+	perPage := int32(sitesPerPage)
+	for page := int32(1); ; page++ {
+		params := &operations.ListSitesParams{
+			Context: ctx,
+			Name:    name,
+			Page:    &page,
+			PerPage: &perPage,
+		}
+
+		var result *operations.ListSitesOK
+		err = h.retry(ctx, func() (e error) {
+			result, e = h.api().ListSites(params, client.BearerToken(h.Token))
+			return
+		})
+
+		if err != nil {
 			return
 		}
+
+		sites = append(sites, result.GetPayload()...)
+		if len(result.GetPayload()) < sitesPerPage {
+			return
+		}
+	}
+}
+
+func findSite(sites []*models.Site, name, accountSlug string) (site *models.Site, err error) {
+	var matches []*models.Site
+	for _, s := range sites {
+		if accountSlug != "" && s.AccountSlug != accountSlug {
+			continue
+		}
+
+		if s.Name == name || strings.EqualFold(s.CustomDomain, name) || containsFold(s.DomainAliases, name) {
+			matches = append(matches, s)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+	case 1:
+		site = matches[0]
+	default:
+		accounts := make([]string, 0, len(matches))
+		for _, m := range matches {
+			accounts = append(accounts, m.AccountSlug)
+		}
+
+		err = fmt.Errorf(
+			"found %d sites matching %s in accounts %s, an account slug is needed to pick one",
+			len(matches), name, strings.Join(accounts, ", "),
+		)
 	}
 
-	err = fmt.Errorf("could not find site with exact name %s", name)
 	return
 }
 
-// GetSiteFiles returns the list of files for a specific site.
-func (h Handler) GetSiteFiles(ctx context.Context, id string) (files []*models.File, err error) {
-	params := &operations.ListSiteFilesParams{
-		Context: h.createContext(ctx),
-		SiteID:  id,
+const maxSimilarSites = 5
+
+// findSimilarSites returns the names of sites that name was probably meant to refer to, either
+// because one contains the other or because name looks like a typo of them.
+func findSimilarSites(sites []*models.Site, name string) (similar []string) {
+	name = strings.ToLower(name)
+
+	for _, s := range sites {
+		for _, candidate := range append([]string{s.Name, s.CustomDomain}, s.DomainAliases...) {
+			candidate = strings.ToLower(candidate)
+			if candidate == "" {
+				continue
+			}
+
+			if strings.Contains(candidate, name) || strings.Contains(name, candidate) ||
+				fuzzy.Distance(name, candidate) <= fuzzy.MaxDistance(name) {
+				similar = append(similar, s.Name)
+				break
+			}
+		}
+
+		if len(similar) == maxSimilarSites {
+			break
+		}
+	}
+
+	return
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+const deployFilesPerPage = 1000
+
+// GetDeployFiles returns the list of files that make up a specific deploy.
+func (h Handler) GetDeployFiles(ctx context.Context, deployID string) (files []*models.File, err error) {
+	for page := int32(1); ; page++ {
+		params := &ListDeployFilesParams{
+			Context:  h.createContext(ctx),
+			DeployID: deployID,
+			Page:     page,
+			PerPage:  deployFilesPerPage,
+		}
+
+		var result []*models.File
+		err = h.retry(ctx, func() (e error) {
+			result, e = h.api().ListDeployFiles(params, client.BearerToken(h.Token))
+			return
+		})
+
+		if err != nil {
+			return
+		}
+
+		files = append(files, result...)
+		if len(result) < deployFilesPerPage {
+			return
+		}
+	}
+}
+
+// GetDeploy returns the deploy of the site with the given ID.
+func (h Handler) GetDeploy(ctx context.Context, siteID, deployID string) (deploy *models.Deploy, err error) {
+	params := &operations.GetSiteDeployParams{
+		Context:  h.createContext(ctx),
+		SiteID:   siteID,
+		DeployID: deployID,
 	}
 
-	var result *operations.ListSiteFilesOK
-	result, err = porcelain.Default.Operations.ListSiteFiles(params, client.BearerToken(h.Token))
+	var result *operations.GetSiteDeployOK
+	err = h.retry(ctx, func() (e error) {
+		result, e = h.api().GetSiteDeploy(params, client.BearerToken(h.Token))
+		return
+	})
+
 	if err != nil {
 		return
 	}
 
-	files = result.GetPayload()
+	deploy = result.GetPayload()
 	return
 }
 
-// GetLatestDeploy returns the most recent deploy for the given site if one exists.
-func (h Handler) GetLatestDeploy(ctx context.Context, id, branch string) (deploy *models.Deploy, err error) {
+// ListDeploys returns the deploys for the given site and branch, newest first.
+func (h Handler) ListDeploys(ctx context.Context, id, branch string) (deploys []*models.Deploy, err error) {
 	params := &operations.ListSiteDeploysParams{
 		Context: h.createContext(ctx),
 		SiteID:  id,
@@ -73,30 +288,180 @@ func (h Handler) GetLatestDeploy(ctx context.Context, id, branch string) (deploy
 	}
 
 	var result *operations.ListSiteDeploysOK
-	result, err = porcelain.Default.Operations.ListSiteDeploys(params, client.BearerToken(h.Token))
+	err = h.retry(ctx, func() (e error) {
+		result, e = h.api().ListSiteDeploys(params, client.BearerToken(h.Token))
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	deploys = result.GetPayload()
+	return
+}
+
+// ErrNoDeploys is returned when a site or branch does not have any deploys yet.
+var ErrNoDeploys = errors.New("no deploys found")
+
+// FindConflictingDeploy returns the newest deploy on the branch that was created after the base deploy
+// but before the given deploy. Such a deploy was created while the given deploy was being prepared, so
+// its files are missing from the given deploy. Deploys that ended in an error are ignored. If baseID
+// is empty, every deploy created before the given deploy is considered.
+func (h Handler) FindConflictingDeploy(ctx context.Context, siteID, branch, baseID, deployID string) (conflict *models.Deploy, err error) {
+	var deploys []*models.Deploy
+	deploys, err = h.ListDeploys(ctx, siteID, branch)
 	if err != nil {
 		return
 	}
 
-	if deploys := result.GetPayload(); len(deploys) > 0 {
-		deploy = deploys[0]
-	} else {
-		err = fmt.Errorf("could not get deploy for site_id:%s branch:%s", id, branch)
+	// Deploys are ordered newest first, so anything between the given deploy and the base deploy is a
+	// conflict. Deploys created after the given deploy are left to whoever created them. Drafts never
+	// become the base of a deploy, so they cannot conflict with it either.
+	created := false
+	for _, d := range deploys {
+		switch {
+		case d.ID == deployID:
+			created = true
+		case d.ID == baseID:
+			return
+		case created && d.State != "error" && !d.Draft:
+			conflict = d
+			return
+		}
+	}
+
+	return
+}
+
+// buildingStates are the states of a deploy that Netlify advances to ready on its own. Deploys that are
+// new, prepared, or uploading need their creator to upload files, which never happens if it was killed.
+// An uploaded deploy has received all of its files.
+var buildingStates = map[string]bool{
+	"enqueued":   true,
+	"building":   true,
+	"uploaded":   true,
+	"preparing":  true,
+	"processing": true,
+	"processed":  true,
+}
+
+// SelectBaseDeploy picks the deploy to base a new deploy on from a list of deploys ordered newest
+// first. The newest deploy in the ready state is returned as base. If a newer deploy is being built
+// by Netlify, the newest such deploy is returned as pending so that it can be waited on and used
+// instead. Drafts, whose files were never published, are skipped along with deploys in any other
+// state.
+func SelectBaseDeploy(deploys []*models.Deploy) (base, pending *models.Deploy) {
+	for _, d := range deploys {
+		if d.Draft {
+			continue
+		}
+
+		switch {
+		case d.State == "ready":
+			base = d
+			return
+		case buildingStates[d.State] && pending == nil:
+			pending = d
+		}
+	}
+
+	return
+}
+
+// SelectRollbackDeploy picks the deploy to restore from a list of deploys ordered newest first, given
+// the ID of the deploy that is currently published. Only deploys in the ready state that are not drafts
+// are considered, since restoring a draft would publish changes that were never reviewed. If target is
+// empty, the newest such deploy that is older than the published deploy is chosen. Otherwise, the
+// deploy whose ID or title equals target is chosen.
+func SelectRollbackDeploy(deploys []*models.Deploy, publishedID, target string) (deploy *models.Deploy, err error) {
+	if target == "" {
+		if publishedID == "" {
+			err = errors.New("the site does not have a published deploy to roll back from")
+			return
+		}
+
+		published := false
+		for _, d := range deploys {
+			switch {
+			case d.ID == publishedID:
+				published = true
+			case published && d.State == "ready" && !d.Draft:
+				deploy = d
+				return
+			}
+		}
+
+		if !published {
+			err = fmt.Errorf("the published deploy %s is not one of the deploys of the branch", publishedID)
+		} else {
+			err = fmt.Errorf("there is no ready deploy before the published deploy %s to roll back to", publishedID)
+		}
+
+		return
+	}
+
+	for _, d := range deploys {
+		if (d.ID == target || d.Title == target) && d.State == "ready" && !d.Draft {
+			deploy = d
+			break
+		}
+	}
+
+	switch {
+	case deploy == nil:
+		err = fmt.Errorf("could not find a ready deploy that is not a draft with ID or title %s", target)
+	case deploy.ID == publishedID:
+		err = fmt.Errorf("deploy %s is already published", deploy.ID)
+		deploy = nil
 	}
 
 	return
 }
 
+// RestoreDeploy republishes a previous deploy of the site.
+func (h Handler) RestoreDeploy(ctx context.Context, siteID, deployID string) (deploy *models.Deploy, err error) {
+	params := &operations.RestoreSiteDeployParams{
+		Context:  h.createContext(ctx),
+		SiteID:   siteID,
+		DeployID: deployID,
+	}
+
+	var result *operations.RestoreSiteDeployCreated
+	err = h.retry(ctx, func() (e error) {
+		result, e = h.api().RestoreSiteDeploy(params, client.BearerToken(h.Token))
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	deploy = result.GetPayload()
+	return
+}
+
 // DeployWithFilesParams contains all of the necessary parameters to initiate a new deployment.
 type DeployWithFilesParams struct {
 	ID     string
 	Title  string
 	Branch string
 	Files  map[string]string
+
+	// Draft creates an unpublished deploy that is only reachable through its unique URL.
+	Draft bool
+
+	// CommitRef and CommitURL link the deploy to the change that produced it in the Netlify UI.
+	CommitRef string
+	CommitURL string
+
+	// Functions maps the names of serverless functions to their SHA256 digests.
+	Functions         map[string]string
+	FunctionSchedules []*models.FunctionSchedule
 }
 
-// NewDeployWithExistingFiles creates a DeployWithFilesParams object from a site ID, branch name, and a list
-// of existing site files.
+// NewDeployWithExistingFiles creates a DeployWithFilesParams object from a site ID, branch name, and the
+// files of the deploy it is based on.
 func NewDeployWithExistingFiles(id, branch string, assets []*models.File) (params *DeployWithFilesParams) {
 	params = &DeployWithFilesParams{
 		ID:     id,
@@ -126,25 +491,155 @@ func (d *DeployWithFilesParams) RegisterFile(path string, content io.ReadSeeker)
 	return
 }
 
-// CreateDeployWithFiles creates a new site deployment.
+// RemoveFiles deletes every file whose path satisfies match from the file list, so that it is no
+// longer part of the deploy. The removed paths are returned in sorted order.
+func (d *DeployWithFilesParams) RemoveFiles(match func(path string) bool) (removed []string) {
+	for path := range d.Files {
+		if match(path) {
+			removed = append(removed, path)
+			delete(d.Files, path)
+		}
+	}
+
+	sort.Strings(removed)
+	return
+}
+
+// edgeFunctionsPath is where Netlify stores edge functions among the files of a deploy.
+const edgeFunctionsPath = "/.netlify/internal/edge-functions/"
+
+// CarryForwardFunctions adds the functions of the base deploy to the new deploy. Functions are
+// referenced by digest, so they do not need to be uploaded again. Edge functions are part of the file
+// list, so an error is returned if the base deploy has edge functions that are not in the file list.
+func (d *DeployWithFilesParams) CarryForwardFunctions(base *models.Deploy, functions *DeployFunctions) (err error) {
+	if functions.EdgeFunctionsPresent {
+		found := false
+		for path := range d.Files {
+			if strings.HasPrefix(path, edgeFunctionsPath) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			err = fmt.Errorf("deploy %s has edge functions that are missing from its file list", base.ID)
+			return
+		}
+	}
+
+	if len(functions.Functions) == 0 {
+		return
+	}
+
+	d.Functions = make(map[string]string, len(functions.Functions))
+	for _, function := range functions.Functions {
+		d.Functions[function.Name] = function.Digest
+	}
+
+	d.FunctionSchedules = base.FunctionSchedules
+	return
+}
+
+// IsRequired reports whether the contents of the file registered at path still need to be uploaded
+// to the given deploy. Netlify lists the SHA1 hashes it does not already have in deploy.Required.
+func (d *DeployWithFilesParams) IsRequired(deploy *models.Deploy, path string) bool {
+	hash, ok := d.Files[path]
+	if !ok {
+		return false
+	}
+
+	for _, required := range deploy.Required {
+		if required == hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequiredFiles splits the given registered paths into the files that still need to be uploaded to
+// the deploy and the files that can be skipped. Netlify needs the contents of each hash only once, so
+// of several files with identical contents only the first path in sorted order is required. Both
+// lists are sorted.
+func (d *DeployWithFilesParams) RequiredFiles(deploy *models.Deploy, paths []string) (required, skipped []string) {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	queued := map[string]bool{}
+	for _, path := range sorted {
+		hash := d.Files[path]
+		if !d.IsRequired(deploy, path) || queued[hash] {
+			skipped = append(skipped, path)
+			continue
+		}
+
+		queued[hash] = true
+		required = append(required, path)
+	}
+
+	return
+}
+
+// GetDeployFunctions returns the serverless and edge functions that are part of the deploy.
+func (h Handler) GetDeployFunctions(ctx context.Context, deploy *models.Deploy) (functions *DeployFunctions, err error) {
+	params := &operations.GetSiteDeployParams{
+		Context:  h.createContext(ctx),
+		SiteID:   deploy.SiteID,
+		DeployID: deploy.ID,
+	}
+
+	err = h.retry(ctx, func() (e error) {
+		functions, e = h.api().GetDeployFunctions(params, client.BearerToken(h.Token))
+		return
+	})
+
+	return
+}
+
+// CreateDeployWithFiles creates a new site deployment. If the deploy carries functions forward and
+// Netlify no longer has all of them, the deploy is returned along with an error because the functions
+// cannot be uploaded by this action.
 func (h Handler) CreateDeployWithFiles(ctx context.Context, deployParams *DeployWithFilesParams) (deploy *models.Deploy, err error) {
-	params := &operations.CreateSiteDeployParams{
+	files := &DeployFiles{
+		DeployFiles: models.DeployFiles{
+			Branch:            deployParams.Branch,
+			Files:             deployParams.Files,
+			Draft:             deployParams.Draft,
+			FunctionSchedules: deployParams.FunctionSchedules,
+		},
+		CommitRef: deployParams.CommitRef,
+		CommitURL: deployParams.CommitURL,
+	}
+
+	if len(deployParams.Functions) > 0 {
+		files.Functions = deployParams.Functions
+	}
+
+	params := &CreateDeployParams{
 		Context: h.createContext(ctx),
 		SiteID:  deployParams.ID,
-		Title:   &deployParams.Title,
-		Deploy: &models.DeployFiles{
-			Branch: deployParams.Branch,
-			Files:  deployParams.Files,
-		},
+		Title:   deployParams.Title,
+		Deploy:  files,
 	}
 
-	var result *operations.CreateSiteDeployOK
-	result, err = porcelain.Default.Operations.CreateSiteDeploy(params, client.BearerToken(h.Token))
+	// Creating a deploy is not idempotent. Retrying after Netlify received the request would leave an
+	// orphaned deploy on the branch that is never finished.
+	err = h.retryUnsent(ctx, func() (e error) {
+		deploy, e = h.api().CreateDeploy(params, client.BearerToken(h.Token))
+		return
+	})
+
 	if err != nil {
 		return
 	}
 
-	deploy = result.GetPayload()
+	if len(deploy.RequiredFunctions) > 0 {
+		err = fmt.Errorf(
+			"could not preserve functions of the previous deploy, Netlify is missing %d of them",
+			len(deploy.RequiredFunctions),
+		)
+	}
+
 	return
 }
 
@@ -152,39 +647,107 @@ func (h Handler) CreateDeployWithFiles(ctx context.Context, deployParams *Deploy
 type DeployFileUploadParams struct {
 	DeployID string
 	Path     string
-	File     io.ReadCloser
+
+	// Open returns the contents of the file. It is called right before the file is uploaded and the
+	// file is closed afterwards, so only the files currently being uploaded are open.
+	Open func() (io.ReadSeekCloser, error)
 }
 
-// UploadFilesToDeploy uploads a slice of files to an open deploy on Netlify.
+// UploadFilesToDeploy uploads a slice of files to an open deploy on Netlify. Up to h.Concurrency
+// files are uploaded at once. Returned files are in the same order as the supplied parameters, with
+// failed uploads omitted.
 func (h Handler) UploadFilesToDeploy(ctx context.Context, deployFiles ...DeployFileUploadParams) (files []*models.File, err error) {
 	ctx = h.createContext(ctx)
+
+	workers := h.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	if workers > len(deployFiles) {
+		workers = len(deployFiles)
+	}
+
+	var (
+		results = make([]*models.File, len(deployFiles))
+		errs    = make([]error, len(deployFiles))
+
+		indices = make(chan int)
+		wg      sync.WaitGroup
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indices {
+				results[i], errs[i] = h.uploadFile(ctx, deployFiles[i])
+			}
+		}()
+	}
+
+	for i := range deployFiles {
+		indices <- i
+	}
+
+	close(indices)
+	wg.Wait()
+
 	files = make([]*models.File, 0, len(deployFiles))
+	for i, result := range results {
+		if errs[i] != nil {
+			err = errors.Join(err, errs[i])
+		} else {
+			files = append(files, result)
+		}
+	}
+
+	return
+}
+
+func (h Handler) uploadFile(ctx context.Context, deployFile DeployFileUploadParams) (file *models.File, err error) {
+	content, err := deployFile.Open()
+	if err != nil {
+		err = fmt.Errorf("error opening file for %s: %w", deployFile.Path, err)
+		return
+	}
+
+	defer content.Close()
+
+	var result *operations.UploadDeployFileOK
+	err = h.retry(ctx, func() (e error) {
+		// Rewind the file in case a previous attempt consumed part of it.
+		if _, e = content.Seek(0, io.SeekStart); e != nil {
+			return
+		}
 
-	for _, deployFile := range deployFiles {
+		// The HTTP client closes request bodies once they are sent, which would prevent the file
+		// from being rewound for another attempt.
 		params := &operations.UploadDeployFileParams{
 			Context:  ctx,
 			DeployID: deployFile.DeployID,
 			Path:     deployFile.Path,
-			FileBody: deployFile.File,
+			FileBody: io.NopCloser(content),
 		}
 
-		result, e := porcelain.Default.Operations.UploadDeployFile(params, client.BearerToken(h.Token))
-		if e != nil {
-			err = errors.Join(err, fmt.Errorf("error uploading file to %s: %w", deployFile.Path, e))
-		} else {
-			files = append(files, result.GetPayload())
-		}
+		result, e = h.api().UploadDeployFile(params, client.BearerToken(h.Token))
+		return
+	})
+
+	if err != nil {
+		err = fmt.Errorf("error uploading file to %s: %w", deployFile.Path, err)
+		return
 	}
 
+	file = result.GetPayload()
 	return
 }
 
-// WaitForDeploy waits until the deploy is ready.
-func (h Handler) WaitForDeploy(ctx context.Context, deploy *models.Deploy) (err error) {
-	ctx = h.createContext(ctx)
-
-	_, err = porcelain.Default.WaitUntilDeployReady(ctx, deploy)
-	return
+// WaitForDeploy waits until the deploy is ready and returns its final state.
+func (h Handler) WaitForDeploy(ctx context.Context, deploy *models.Deploy) (ready *models.Deploy, err error) {
+	return h.waitForState(ctx, deploy, "ready")
 }
 
 // DestroyDeploy cancels and then deletes the deploy with the given ID.
@@ -195,25 +758,33 @@ func (h Handler) DestroyDeploy(ctx context.Context, id string) (err error) {
 
 	ctx = h.createContext(ctx)
 
-	_, err = porcelain.Default.Operations.CancelSiteDeploy(
-		&operations.CancelSiteDeployParams{
-			Context:  ctx,
-			DeployID: id,
-		},
-		client.BearerToken(h.Token),
-	)
+	err = h.retry(ctx, func() (e error) {
+		_, e = h.api().CancelSiteDeploy(
+			&operations.CancelSiteDeployParams{
+				Context:  ctx,
+				DeployID: id,
+			},
+			client.BearerToken(h.Token),
+		)
+
+		return
+	})
 
 	if err != nil {
 		return
 	}
 
-	_, err = porcelain.Default.Operations.DeleteDeploy(
-		&operations.DeleteDeployParams{
-			Context:  ctx,
-			DeployID: id,
-		},
-		client.BearerToken(h.Token),
-	)
+	err = h.retry(ctx, func() (e error) {
+		_, e = h.api().DeleteDeploy(
+			&operations.DeleteDeployParams{
+				Context:  ctx,
+				DeployID: id,
+			},
+			client.BearerToken(h.Token),
+		)
+
+		return
+	})
 
 	return
 }
@@ -0,0 +1,870 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mrflynn/upload-to-netlify-action/internal/netlifytest"
+	"github.com/netlify/open-api/v2/go/models"
+)
+
+const token = "secret-token"
+
+func newTestHandler(t *testing.T) (Handler, *netlifytest.Server) {
+	t.Helper()
+
+	server := netlifytest.NewServer(t)
+	server.Token = token
+
+	return Handler{
+		Token:       token,
+		Concurrency: 4,
+		Retry:       RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		Poll:        PollPolicy{Interval: time.Millisecond, MaxInterval: 4 * time.Millisecond},
+		Client:      NewClient(server.Transport()),
+	}, server
+}
+
+type readSeekNopCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
+
+func newFile(content string) io.ReadSeekCloser {
+	return readSeekNopCloser{bytes.NewReader([]byte(content))}
+}
+
+func openFile(content string) func() (io.ReadSeekCloser, error) {
+	return func() (io.ReadSeekCloser, error) {
+		return newFile(content), nil
+	}
+}
+
+// openFiles counts the files that are open, and the most that were open at the same time.
+type openFiles struct {
+	open, peak int32
+}
+
+// countedFile keeps track of how many files are open through a shared counter.
+type countedFile struct {
+	io.ReadSeekCloser
+	files *openFiles
+}
+
+func (f countedFile) Close() error {
+	// Stay open for a moment so that uploads running in parallel overlap.
+	time.Sleep(5 * time.Millisecond)
+
+	atomic.AddInt32(&f.files.open, -1)
+	return f.ReadSeekCloser.Close()
+}
+
+func openCountedFile(content string, files *openFiles) func() (io.ReadSeekCloser, error) {
+	return func() (io.ReadSeekCloser, error) {
+		open := atomic.AddInt32(&files.open, 1)
+		for peak := atomic.LoadInt32(&files.peak); open > peak; peak = atomic.LoadInt32(&files.peak) {
+			if atomic.CompareAndSwapInt32(&files.peak, peak, open) {
+				break
+			}
+		}
+
+		return countedFile{ReadSeekCloser: newFile(content), files: files}, nil
+	}
+}
+
+func hash(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHandler_GetSite(t *testing.T) {
+	handler, server := newTestHandler(t)
+
+	server.AddSite(&models.Site{Name: "docs", AccountSlug: "personal"})
+	server.AddSite(&models.Site{Name: "docs", AccountSlug: "team"})
+	server.AddSite(&models.Site{
+		Name:          "blog-4f2a",
+		AccountSlug:   "team",
+		CustomDomain:  "blog.example.com",
+		DomainAliases: []string{"www.blog.example.com"},
+	})
+
+	testCases := []struct {
+		name        string
+		query       string
+		accountSlug string
+		result      string
+		errored     bool
+	}{
+		{name: "by_name_and_account", query: "docs", accountSlug: "team", result: "docs"},
+		{name: "by_custom_domain", query: "blog.example.com", result: "blog-4f2a"},
+		{name: "by_domain_alias", query: "WWW.blog.example.com", result: "blog-4f2a"},
+		{name: "ambiguous_name", query: "docs", errored: true},
+		{name: "wrong_account", query: "blog-4f2a", accountSlug: "personal", errored: true},
+		{name: "missing", query: "blog", errored: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			site, err := handler.GetSite(context.Background(), tc.query, tc.accountSlug)
+			if tc.errored {
+				if err == nil {
+					t.Errorf("Expected an error, got site %s", site.Name)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, site.Name); diff != "" {
+				t.Errorf("Site mismatch (-want +got):\n%s", diff)
+			}
+
+			if tc.accountSlug != "" && site.AccountSlug != tc.accountSlug {
+				t.Errorf("Expected site in account %s, got %s", tc.accountSlug, site.AccountSlug)
+			}
+		})
+	}
+}
+
+func TestHandler_GetSite_SimilarSites(t *testing.T) {
+	handler, server := newTestHandler(t)
+	server.AddSite(&models.Site{Name: "blog-4f2a"})
+	server.AddSite(&models.Site{Name: "my-site"})
+	server.AddSite(&models.Site{Name: "shop", CustomDomain: "shop.example.com"})
+
+	testCases := []struct {
+		name    string
+		lookup  string
+		message string
+	}{
+		{
+			name:    "prefix",
+			lookup:  "blog",
+			message: "could not find site with name or domain blog (similar sites: blog-4f2a)",
+		},
+		{
+			name:    "typo",
+			lookup:  "my-stie",
+			message: "could not find site with name or domain my-stie (similar sites: my-site)",
+		},
+		{
+			name:    "domain_typo",
+			lookup:  "shop.exmaple.com",
+			message: "could not find site with name or domain shop.exmaple.com (similar sites: shop)",
+		},
+		{
+			name:    "unrelated",
+			lookup:  "wiki",
+			message: "could not find site with name or domain wiki",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := handler.GetSite(context.Background(), tc.lookup, "")
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+
+			if diff := cmp.Diff(tc.message, err.Error()); diff != "" {
+				t.Errorf("Error mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandler_GetSiteByID(t *testing.T) {
+	handler, server := newTestHandler(t)
+	expected := server.AddSite(&models.Site{Name: "docs"})
+
+	site, err := handler.GetSiteByID(context.Background(), expected.ID)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+		return
+	}
+
+	if diff := cmp.Diff(expected.Name, site.Name); diff != "" {
+		t.Errorf("Site mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandler_DeployPipeline(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	base := server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, map[string][]byte{
+		"/index.html": []byte("index"),
+		"/old.pdf":    []byte("old"),
+	})
+
+	files, err := handler.GetDeployFiles(ctx, base.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error getting base deploy files: %s", err)
+	}
+
+	params := NewDeployWithExistingFiles(site.ID, "main", files)
+	params.RemoveFiles(func(path string) bool { return path == "/old.pdf" })
+	params.Title = "main@1a2b3c4"
+	params.CommitRef = "1a2b3c4d5e6f"
+	params.CommitURL = "https://github.com/octocat/docs/actions/runs/42"
+
+	sources := map[string]string{
+		"docs/new.pdf":  "new",
+		"docs/copy.txt": "index",
+	}
+
+	for path, content := range sources {
+		if err = params.RegisterFile("/"+path, newFile(content)); err != nil {
+			t.Fatalf("Unexpected error registering %s: %s", path, err)
+		}
+	}
+
+	deploy, err := handler.CreateDeployWithFiles(ctx, params)
+	if err != nil {
+		t.Fatalf("Unexpected error creating deploy: %s", err)
+	}
+
+	if diff := cmp.Diff("prepared", deploy.State); diff != "" {
+		t.Errorf("State before uploading mismatch (-want +got):\n%s", diff)
+	}
+
+	var uploads []DeployFileUploadParams
+	for path, content := range sources {
+		if params.IsRequired(deploy, "/"+path) {
+			uploads = append(uploads, DeployFileUploadParams{DeployID: deploy.ID, Path: path, Open: openFile(content)})
+		}
+	}
+
+	if len(uploads) != 1 || uploads[0].Path != "docs/new.pdf" {
+		t.Fatalf("Expected only docs/new.pdf to be required, got %+v", uploads)
+	}
+
+	if _, err = handler.UploadFilesToDeploy(ctx, uploads...); err != nil {
+		t.Fatalf("Unexpected error uploading files: %s", err)
+	}
+
+	ready, err := handler.WaitForDeploy(ctx, deploy)
+	if err != nil {
+		t.Fatalf("Unexpected error waiting for deploy: %s", err)
+	}
+
+	if diff := cmp.Diff("ready", ready.State); diff != "" {
+		t.Errorf("State mismatch (-want +got):\n%s", diff)
+	}
+
+	metadata := []string{ready.Title, ready.CommitRef, ready.CommitURL}
+	if diff := cmp.Diff([]string{params.Title, params.CommitRef, params.CommitURL}, metadata); diff != "" {
+		t.Errorf("Deploy metadata mismatch (-want +got):\n%s", diff)
+	}
+
+	expected := map[string]string{
+		"/index.html":    hash("index"),
+		"/docs/new.pdf":  hash("new"),
+		"/docs/copy.txt": hash("index"),
+	}
+
+	if diff := cmp.Diff(expected, server.DeployFiles(deploy.ID)); diff != "" {
+		t.Errorf("Deploy files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandler_UploadFilesToDeploy(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+
+	params := NewDeployWithExistingFiles(site.ID, "main", nil)
+
+	contents := []string{"a", "b", "c", "d", "e", "f"}
+	uploads := make([]DeployFileUploadParams, 0, len(contents))
+
+	var files openFiles
+
+	for _, content := range contents {
+		if err := params.RegisterFile("/"+content+".txt", newFile(content)); err != nil {
+			t.Fatal(err)
+		}
+
+		uploads = append(uploads, DeployFileUploadParams{Path: content + ".txt", Open: openCountedFile(content, &files)})
+	}
+
+	deploy, err := handler.CreateDeployWithFiles(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range uploads {
+		uploads[i].DeployID = deploy.ID
+	}
+
+	// Transient failures are retried and the file is rewound before it is sent again.
+	server.FailRequests(http.MethodPut, "/deploys/"+deploy.ID+"/files/c.txt", 2, http.StatusBadGateway, nil)
+
+	// Permanent failures are reported without affecting the other files.
+	server.FailRequests(http.MethodPut, "/deploys/"+deploy.ID+"/files/e.txt", 1, http.StatusForbidden, nil)
+
+	uploaded, err := handler.UploadFilesToDeploy(ctx, uploads...)
+	if err == nil {
+		t.Error("Expected an error for e.txt")
+	}
+
+	var paths []string
+	for _, f := range uploaded {
+		paths = append(paths, f.Path)
+	}
+
+	if diff := cmp.Diff([]string{"/a.txt", "/b.txt", "/c.txt", "/d.txt", "/f.txt"}, paths); diff != "" {
+		t.Errorf("Uploaded files mismatch (-want +got):\n%s", diff)
+	}
+
+	if content, _ := server.Blob(hash("c")); string(content) != "c" {
+		t.Errorf("Expected retried upload to contain %q, got %q", "c", content)
+	}
+
+	if files.open != 0 {
+		t.Errorf("Expected every file to be closed after uploading, %d are still open", files.open)
+	}
+
+	// Files are uploaded in parallel, but never more than Concurrency at a time.
+	if files.peak < 2 || files.peak > int32(handler.Concurrency) {
+		t.Errorf("Expected from 2 to %d files to be uploaded at once, got %d", handler.Concurrency, files.peak)
+	}
+}
+
+func TestHandler_DestroyDeploy(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	deploy := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "uploading"}, nil)
+
+	if err := handler.DestroyDeploy(ctx, deploy.ID); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if server.Deploy(deploy.ID) != nil {
+		t.Error("Expected deploy to be deleted")
+	}
+}
+
+func TestHandler_RestoreDeploy(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	first := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", Title: "first"}, nil)
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "error"}, nil)
+	second := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", Title: "second"}, nil)
+
+	deploys, err := handler.ListDeploys(ctx, site.ID, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := SelectRollbackDeploy(deploys, second.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(first.ID, target.ID); diff != "" {
+		t.Fatalf("Rollback target mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err = handler.RestoreDeploy(ctx, site.ID, target.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := handler.WaitForPublishedDeploy(ctx, site.ID, target.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(first.ID, published.PublishedDeploy.ID); diff != "" {
+		t.Errorf("Published deploy mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandler_WaitForPublishedDeploy_Timeout(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	handler.Poll.Timeout = 20 * time.Millisecond
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	first := server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+
+	_, err := handler.WaitForPublishedDeploy(ctx, site.ID, first.ID)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to time out, got: %v", err)
+	}
+}
+
+func TestHandler_FindConflictingDeploy(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	base := server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+	concurrent := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "processing"}, nil)
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "error"}, nil)
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "staging"}, nil)
+	// Drafts between the base and the new deploy are not conflicts.
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main", Draft: true}, nil)
+	deploy := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "uploading"}, nil)
+	later := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "uploading"}, nil)
+
+	testCases := []struct {
+		name     string
+		baseID   string
+		deployID string
+		conflict string
+	}{
+		{name: "concurrent_deploy", baseID: base.ID, deployID: deploy.ID, conflict: concurrent.ID},
+		{name: "no_base", deployID: deploy.ID, conflict: concurrent.ID},
+		{name: "up_to_date", baseID: concurrent.ID, deployID: deploy.ID},
+		{name: "later_deploy", baseID: deploy.ID, deployID: later.ID},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conflict, err := handler.FindConflictingDeploy(ctx, site.ID, "main", tc.baseID, tc.deployID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			var id string
+			if conflict != nil {
+				id = conflict.ID
+			}
+
+			if diff := cmp.Diff(tc.conflict, id); diff != "" {
+				t.Errorf("Conflicting deploy mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandler_WaitForDeploy(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	deploy := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "processing"}, nil)
+
+	var transitions []string
+	handler.StateChanged = func(d *models.Deploy, previous string) {
+		transitions = append(transitions, previous+"->"+d.State)
+	}
+
+	ready, err := handler.WaitForDeploy(ctx, deploy)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff("ready", ready.State); diff != "" {
+		t.Errorf("State mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"->processing", "processing->ready"}, transitions); diff != "" {
+		t.Errorf("Transitions mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandler_WaitForDeploy_Error(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	deploy := server.AddDeploy(site.ID, &models.Deploy{
+		Branch:       "main",
+		State:        "error",
+		ErrorMessage: "Build script returned non-zero exit code: 2",
+	}, nil)
+
+	_, err := handler.WaitForDeploy(ctx, deploy)
+
+	var deployErr *DeployError
+	if !errors.As(err, &deployErr) {
+		t.Fatalf("Expected a DeployError, got: %v", err)
+	}
+
+	expected := &DeployError{DeployID: deploy.ID, Message: "Build script returned non-zero exit code: 2"}
+	if diff := cmp.Diff(expected, deployErr); diff != "" {
+		t.Errorf("Error mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandler_WaitForDeploy_Timeout(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	handler.Poll.Timeout = 20 * time.Millisecond
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	deploy := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "uploading"}, nil)
+
+	_, err := handler.WaitForDeploy(ctx, deploy)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to time out, got: %v", err)
+	}
+}
+
+func TestHandler_WaitForDeploy_Prepared(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	handler.Poll.Timeout = 20 * time.Millisecond
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+
+	params := NewDeployWithExistingFiles(site.ID, "main", nil)
+	if err := params.RegisterFile("/index.html", newFile("index")); err != nil {
+		t.Fatal(err)
+	}
+
+	deploy, err := handler.CreateDeployWithFiles(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A prepared deploy is still waiting for its files, so it is not ready.
+	_, err = handler.WaitForDeploy(ctx, deploy)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to time out, got: %v", err)
+	}
+}
+
+func Test_SelectBaseDeploy(t *testing.T) {
+	testCases := []struct {
+		name    string
+		deploys []*models.Deploy
+		base    string
+		pending string
+	}{
+		{
+			name: "latest_ready",
+			deploys: []*models.Deploy{
+				{ID: "3", State: "ready"},
+				{ID: "2", State: "ready"},
+			},
+			base: "3",
+		},
+		{
+			name: "skip_errors",
+			deploys: []*models.Deploy{
+				{ID: "3", State: "error"},
+				{ID: "2", State: "error"},
+				{ID: "1", State: "ready"},
+			},
+			base: "1",
+		},
+		{
+			name: "building",
+			deploys: []*models.Deploy{
+				{ID: "4", State: "error"},
+				{ID: "3", State: "processing"},
+				{ID: "2", State: "uploading"},
+				{ID: "1", State: "ready"},
+			},
+			base:    "1",
+			pending: "3",
+		},
+		{
+			name: "abandoned",
+			deploys: []*models.Deploy{
+				{ID: "3", State: "uploading"},
+				{ID: "2", State: "new"},
+				{ID: "1", State: "ready"},
+			},
+			base: "1",
+		},
+		{
+			name: "prepared",
+			deploys: []*models.Deploy{
+				{ID: "2", State: "prepared"},
+				{ID: "1", State: "ready"},
+			},
+			base: "1",
+		},
+		{
+			name: "skip_drafts",
+			deploys: []*models.Deploy{
+				{ID: "3", State: "ready", Draft: true},
+				{ID: "2", State: "processing", Draft: true},
+				{ID: "1", State: "ready"},
+			},
+			base: "1",
+		},
+		{
+			name: "nothing_ready",
+			deploys: []*models.Deploy{
+				{ID: "2", State: "building"},
+				{ID: "1", State: "error"},
+			},
+			pending: "2",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			base, pending := SelectBaseDeploy(tc.deploys)
+
+			var baseID, pendingID string
+			if base != nil {
+				baseID = base.ID
+			}
+
+			if pending != nil {
+				pendingID = pending.ID
+			}
+
+			if diff := cmp.Diff(tc.base, baseID); diff != "" {
+				t.Errorf("Base deploy mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.pending, pendingID); diff != "" {
+				t.Errorf("Pending deploy mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_SelectRollbackDeploy(t *testing.T) {
+	deploys := []*models.Deploy{
+		{ID: "6", State: "ready", Title: "main@6"},
+		{ID: "5", State: "ready", Title: "main@5", Draft: true},
+		{ID: "4", State: "ready", Title: "main@4"},
+		{ID: "3", State: "error", Title: "main@3"},
+		{ID: "2", State: "ready", Title: "main@2", Draft: true},
+		{ID: "1", State: "ready", Title: "main@1"},
+	}
+
+	testCases := []struct {
+		name      string
+		published string
+		target    string
+		result    string
+		errored   bool
+	}{
+		{name: "previous", published: "4", result: "1"},
+		{name: "rolled_back", published: "1", errored: true},
+		{name: "skip_drafts", published: "6", result: "4"},
+		{name: "not_published", published: "7", errored: true},
+		{name: "no_published_deploy", errored: true},
+		{name: "by_id", published: "4", target: "1", result: "1"},
+		{name: "by_title", published: "1", target: "main@6", result: "6"},
+		{name: "not_ready", published: "4", target: "3", errored: true},
+		{name: "draft", published: "4", target: "main@2", errored: true},
+		{name: "already_published", published: "4", target: "4", errored: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deploy, err := SelectRollbackDeploy(deploys, tc.published, tc.target)
+			if tc.errored {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+				return
+			}
+
+			if diff := cmp.Diff(tc.result, deploy.ID); diff != "" {
+				t.Errorf("Deploy mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeployWithFilesParams_RemoveFiles(t *testing.T) {
+	params := &DeployWithFilesParams{Files: map[string]string{
+		"/a.txt":     "1",
+		"/dir/b.txt": "2",
+		"/dir/c.txt": "3",
+	}}
+
+	removed := params.RemoveFiles(func(path string) bool { return path != "/a.txt" })
+
+	if diff := cmp.Diff([]string{"/dir/b.txt", "/dir/c.txt"}, removed); diff != "" {
+		t.Errorf("Removed mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(map[string]string{"/a.txt": "1"}, params.Files, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("Files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeployWithFilesParams_RequiredFiles(t *testing.T) {
+	params := &DeployWithFilesParams{Files: map[string]string{
+		"/index.html":    "1",
+		"/copy.html":     "1",
+		"/report.pdf":    "2",
+		"/unchanged.txt": "3",
+	}}
+
+	deploy := &models.Deploy{Required: []string{"1", "2"}}
+
+	required, skipped := params.RequiredFiles(
+		deploy, []string{"/report.pdf", "/index.html", "/copy.html", "/unchanged.txt"},
+	)
+
+	if diff := cmp.Diff([]string{"/copy.html", "/report.pdf"}, required); diff != "" {
+		t.Errorf("Required mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"/index.html", "/unchanged.txt"}, skipped); diff != "" {
+		t.Errorf("Skipped mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandler_CarryForwardFunctions(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	base := server.AddDeploy(site.ID, &models.Deploy{
+		Branch: "main",
+		FunctionSchedules: []*models.FunctionSchedule{
+			{Name: "nightly", Cron: "@daily"},
+		},
+	}, map[string][]byte{
+		"/index.html": []byte("index"),
+	})
+
+	server.SetDeployFunctions(base.ID, map[string]string{"nightly": "abc123", "search": "def456"}, false)
+
+	functions, err := handler.GetDeployFunctions(ctx, base)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	files, err := handler.GetDeployFiles(ctx, base.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := NewDeployWithExistingFiles(site.ID, "main", files)
+	if err = params.CarryForwardFunctions(base, functions); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	deploy, err := handler.CreateDeployWithFiles(ctx, params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(
+		map[string]string{"nightly": "abc123", "search": "def456"}, server.DeployFunctions(deploy.ID),
+	); diff != "" {
+		t.Errorf("Functions mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(base.FunctionSchedules, params.FunctionSchedules); diff != "" {
+		t.Errorf("Schedules mismatch (-want +got):\n%s", diff)
+	}
+
+	// Netlify would require the function to be uploaded again, which is not possible.
+	server.ForgetFunction("def456")
+
+	if _, err = handler.CreateDeployWithFiles(ctx, params); err == nil {
+		t.Error("Expected an error when Netlify is missing a function")
+	}
+}
+
+func TestDeployWithFilesParams_CarryForwardFunctions_EdgeFunctions(t *testing.T) {
+	base := &models.Deploy{ID: "1"}
+	functions := &DeployFunctions{EdgeFunctionsPresent: true}
+
+	params := &DeployWithFilesParams{Files: map[string]string{"/index.html": "1"}}
+	if err := params.CarryForwardFunctions(base, functions); err == nil {
+		t.Error("Expected an error when edge functions are missing from the file list")
+	}
+
+	params.Files["/.netlify/internal/edge-functions/manifest.json"] = "2"
+	if err := params.CarryForwardFunctions(base, functions); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestHandler_GetDeployFiles(t *testing.T) {
+	var (
+		handler, server = newTestHandler(t)
+		ctx             = context.Background()
+	)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, map[string][]byte{
+		"/index.html": []byte("production"),
+	})
+
+	base := server.AddDeploy(site.ID, &models.Deploy{Branch: "staging", Draft: true}, map[string][]byte{
+		"/index.html":  []byte("staging"),
+		"/preview.pdf": []byte("preview"),
+	})
+
+	files, err := handler.GetDeployFiles(ctx, base.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	params := NewDeployWithExistingFiles(site.ID, "staging", files)
+	expected := map[string]string{
+		"/index.html":  hash("staging"),
+		"/preview.pdf": hash("preview"),
+	}
+
+	if diff := cmp.Diff(expected, params.Files); diff != "" {
+		t.Errorf("Files mismatch (-want +got):\n%s", diff)
+	}
+}
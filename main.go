@@ -2,18 +2,21 @@ package main
 
 import (
 	"context"
+	_ "embed"
 	"errors"
 	"fmt"
-	"io"
+	"math"
 	"os"
 	"os/signal"
 	"regexp"
 	"strings"
 	"syscall"
+	"text/template"
 
-	"github.com/mrflynn/go-joinederror"
 	"github.com/mrflynn/upload-to-netlify-action/internal/actions"
+	"github.com/mrflynn/upload-to-netlify-action/internal/source"
 	"github.com/mrflynn/upload-to-netlify-action/internal/upload"
+	"github.com/netlify/open-api/v2/go/models"
 )
 
 // Program information set during compile.
@@ -22,222 +25,274 @@ var version, commit, date string
 // Program logger.
 var logger = actions.NewLogger()
 
-// Program variables.
-var (
-	siteName   string
-	branchName string
+// Modes of operation.
+const (
+	modeUpload   = "upload"
+	modeRollback = "rollback"
+)
 
-	sourceFiles      []string
-	destinationPaths []string
+// Policies for choosing a base deploy when the branch does not have any deploys yet.
+const (
+	fallbackFail       = "fail"
+	fallbackEmpty      = "empty"
+	fallbackProduction = "production"
 )
 
-// Netlify handler
-var handler upload.Handler
+// actionMetadata is the action.yml of the action, which declares the inputs and their defaults.
+//
+//go:embed action.yml
+var actionMetadata []byte
 
-func init() {
-	logger.Debugf(
-		"upload-to-netlify-action %s (commit: %s, compiled: %s)",
-		version, commit, date,
-	)
+// inputs holds the inputs of the action.
+type inputs struct {
+	mode        string
+	siteID      string
+	siteName    string
+	accountSlug string
+	branchName  string
 
-	var (
-		netlifyToken string
-		err          error
+	rollbackTarget  string
+	baseDeployID    string
+	baseFallback    string
+	conflictRetries int
 
-		opts = actions.GetInputOptions{
-			Required:       true,
-			TrimWhitespace: true,
-		}
-	)
+	sourceFiles      []string
+	destinationPaths []string
+	sourceOptions    source.Options
+
+	deletePaths []string
+	syncMode    bool
+	draftMode   bool
 
-	netlifyToken, err = actions.GetInput("netlify-token", opts)
+	githubContext actions.Context
+	titleTemplate *template.Template
+}
+
+// newUploader reads the inputs of the action and configures the Netlify handler. Every problem with
+// the inputs is returned so that they can all be reported at once.
+func newUploader() (u *uploader, problems []error) {
+	metadata, err := actions.ParseMetadata(actionMetadata)
 	if err != nil {
-		logger.Error("Netlify API token is required!")
-		os.Exit(1)
-	} else {
-		logger.SetSecret(netlifyToken)
+		problems = append(problems, fmt.Errorf("could not read the bundled action.yml: %w", err))
+		return
 	}
 
-	siteName, err = actions.GetInput("site-name", opts)
-	if err != nil {
-		logger.Error("Name of Netlify site is required!")
-		os.Exit(1)
+	for _, unknown := range metadata.UnknownInputs(nil) {
+		logger.Warn(capitalize(unknown.String()))
 	}
 
-	branchName, err = actions.GetInput("branch-name", opts)
-	if err != nil {
-		branchName = "main"
-		logger.Warn("Could not get value of branch-name, assuming 'main'")
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
 	}
 
-	sourceFiles, err = actions.GetMultilineInput("source-file", opts)
-	if err != nil {
-		logger.Error("At least one source file must be given.")
-		os.Exit(1)
+	// options returns the options of an input as declared in action.yml.
+	options := func(name string) actions.GetInputOptions {
+		o, err := metadata.Options(name)
+		check(err)
+		return o
 	}
 
-	destinationPaths, err = actions.GetMultilineInput("destination-path", opts)
-	if err != nil {
-		logger.Error("At least one destination path must be given.")
-		os.Exit(1)
+	u = &uploader{}
+
+	netlifyToken, err := actions.GetInput("netlify-token", options("netlify-token"))
+	check(err)
+
+	if netlifyToken != "" {
+		logger.SetSecret(netlifyToken)
 	}
 
-	handler = upload.Handler{Token: netlifyToken}
-}
+	u.siteID, _ = actions.GetInput("site-id", options("site-id"))
+	u.siteName, _ = actions.GetInput("site-name", options("site-name"))
+	u.accountSlug, _ = actions.GetInput("account-slug", options("account-slug"))
+	u.branchName, _ = actions.GetInput("branch-name", options("branch-name"))
 
-func handleError(ctx context.Context, err error, deployID *string) {
-	// Log error, but capitalize the first letter.
-	logger.Error(
-		regexp.MustCompile(`^\w`).ReplaceAllStringFunc(err.Error(), func(s string) string {
-			return strings.ToUpper(s)
-		}),
-	)
+	if u.siteName == "" && u.siteID == "" {
+		check(errors.New("either site-name or site-id must be given"))
+	}
 
-	if deployID != nil {
-		if destroyErr := handler.DestroyDeploy(ctx, *deployID); destroyErr != nil {
-			logger.Errorf("Error while trying to destroy deploy: %s", destroyErr)
+	// The mode can also be given as the first argument to the binary, e.g. netlify-uploader rollback.
+	if len(os.Args) > 1 {
+		u.mode = os.Args[1]
+		if u.mode != modeUpload && u.mode != modeRollback {
+			check(fmt.Errorf("unknown mode %s, expected one of: %s, %s", u.mode, modeUpload, modeRollback))
 		}
+	} else {
+		u.mode, err = actions.GetEnumInput("mode", []string{modeUpload, modeRollback}, options("mode"))
+		check(err)
 	}
 
-	os.Exit(1)
-}
-
-func cleanDestinationPath(path string) (cleaned string, err error) {
-	if regexp.MustCompile("[#?]").MatchString(path) {
-		err = fmt.Errorf("path %s contains one of the following illegal characters: #, ?", path)
-		return
+	if u.mode == modeRollback {
+		u.rollbackTarget, _ = actions.GetInput("rollback-to", options("rollback-to"))
 	}
 
-	cleaned = strings.TrimPrefix(path, "/")
-	return
-}
+	if u.mode == modeUpload {
+		u.baseDeployID, _ = actions.GetInput("base-deploy-id", options("base-deploy-id"))
 
-func getReadersForSourceFiles() (rs map[string]io.ReadSeekCloser, err error) {
-	rs = make(map[string]io.ReadSeekCloser, len(destinationPaths))
+		u.baseFallback, err = actions.GetEnumInput(
+			"base-fallback", []string{fallbackFail, fallbackEmpty, fallbackProduction}, options("base-fallback"),
+		)
+		check(err)
 
-	var (
-		file *os.File
-		dest string
-	)
+		u.conflictRetries, err = actions.GetIntegerInput(
+			"conflict-retries", 0, math.MaxInt, options("conflict-retries"),
+		)
+		check(err)
 
-	for i, sourceFile := range sourceFiles {
-		file, err = os.Open(sourceFile)
-		if err != nil {
-			err = fmt.Errorf("error opening source file %s: %w", sourceFile, err)
-			return
-		}
+		// Source files and destination paths are only required in upload mode, so action.yml cannot
+		// declare them as required.
+		sourceFileOptions := options("source-file")
+		sourceFileOptions.Required = true
 
-		dest, err = cleanDestinationPath(destinationPaths[i])
-		if err != nil {
-			err = fmt.Errorf("error in destination path %s: %w", destinationPaths[i], err)
-			return
-		}
+		u.sourceFiles, err = actions.GetMultilineInput("source-file", sourceFileOptions)
+		check(err)
 
-		rs[dest] = file
-	}
+		destinationOptions := options("destination-path")
+		destinationOptions.Required = true
 
-	return
-}
+		u.destinationPaths, err = actions.GetMultilineInput("destination-path", destinationOptions)
+		check(err)
 
-func createDeployTitle() (title string) {
-	gitSha := os.Getenv("GITHUB_SHA")
-	if len(gitSha) >= 7 {
-		gitSha = gitSha[:7]
+		if len(u.sourceFiles) > 0 && len(u.destinationPaths) > 0 && len(u.sourceFiles) != len(u.destinationPaths) {
+			check(fmt.Errorf(
+				"every source-file entry needs a destination-path, got %d sources and %d destinations",
+				len(u.sourceFiles), len(u.destinationPaths),
+			))
+		}
 	}
 
-	title = fmt.Sprintf("%s@%s via upload-to-netlify-action", branchName, gitSha)
-	return
-}
+	u.githubContext = actions.GetContext()
 
-func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	title, _ := actions.GetInput("deploy-title", options("deploy-title"))
 
-	// Get site information.
-	site, err := handler.GetSite(ctx, siteName)
+	u.titleTemplate, err = parseDeployTitle(title, titleData{Context: u.githubContext, Branch: u.branchName})
 	if err != nil {
-		handleError(ctx, fmt.Errorf("error getting details for site %s: %w", siteName, err), nil)
+		check(fmt.Errorf("input deploy-title is not a valid template: %w", err))
 	}
 
-	logger.Debugf("Got site ID for %s (ID: %s)", siteName, site.ID)
+	u.deletePaths, _ = actions.GetMultilineInput("delete-path", options("delete-path"))
 
-	// Get latest deploy and wait until it has completed.
-	deploy, err := handler.GetLatestDeploy(ctx, site.ID, branchName)
-	if err != nil {
-		handleError(ctx, fmt.Errorf("error getting latest deploy: %w", err), nil)
-	}
+	u.syncMode, err = actions.GetBooleanInput("sync", options("sync"))
+	check(err)
 
-	logger.Debugf("Got latest deploy for site ID %s (deployID: %s)", site.ID, deploy.ID)
+	u.draftMode, err = actions.GetBooleanInput("draft", options("draft"))
+	check(err)
 
-	err = handler.WaitForDeploy(ctx, deploy)
-	if err != nil {
-		handleError(ctx, fmt.Errorf("encountered error waiting for deploy to complete: %w", err), nil)
-	}
+	u.sourceOptions.FollowSymlinks, err = actions.GetBooleanInput("follow-symlinks", options("follow-symlinks"))
+	check(err)
 
-	// Get site files.
-	files, err := handler.GetSiteFiles(ctx, site.ID)
-	if err != nil {
-		handleError(ctx, fmt.Errorf("error getting files for site: %w", err), nil)
-	}
+	u.sourceOptions.ExcludeHidden, err = actions.GetBooleanInput("exclude-hidden", options("exclude-hidden"))
+	check(err)
+
+	concurrency, err := actions.GetIntegerInput(
+		"upload-concurrency", 1, math.MaxInt, options("upload-concurrency"),
+	)
+	check(err)
 
-	logger.Debugf("Got %d preexisting files from site ID %s", len(files), site.ID)
+	retry := upload.DefaultRetryPolicy
+	retry.MaxAttempts, err = actions.GetIntegerInput(
+		"retry-max-attempts", 1, math.MaxInt, options("retry-max-attempts"),
+	)
+	check(err)
 
-	sourceFileReaders, err := getReadersForSourceFiles()
-	if err != nil {
-		handleError(ctx, err, nil)
+	retry.BaseDelay, err = actions.GetDurationInput("retry-base-delay", options("retry-base-delay"))
+	check(err)
+
+	poll := upload.DefaultPollPolicy
+	poll.Timeout, err = actions.GetDurationInput("deploy-timeout", options("deploy-timeout"))
+	check(err)
+
+	poll.Interval, err = actions.GetDurationInput("deploy-poll-interval", options("deploy-poll-interval"))
+	check(err)
+
+	if err == nil && poll.Interval == 0 {
+		check(errors.New("input deploy-poll-interval must be greater than zero"))
 	}
 
-	deployParams := upload.NewDeployWithExistingFiles(site.ID, branchName, files)
-	for path, reader := range sourceFileReaders {
-		err = deployParams.RegisterFile("/"+path, reader)
-		if err != nil {
-			handleError(ctx, fmt.Errorf("error preparing file %s for upload: %w", path, err), nil)
-		}
+	// The delay backs off up to the default cap, but never below the interval that was asked for.
+	if poll.MaxInterval < poll.Interval {
+		poll.MaxInterval = poll.Interval
+	}
 
-		logger.Debugf("Registered file %s", path)
+	clientOptions := upload.ClientOptions{
+		UserAgent: fmt.Sprintf("upload-to-netlify-action/%s (commit: %s)", version, commit),
 	}
 
-	deployParams.Title = createDeployTitle()
+	clientOptions.Host, _ = actions.GetInput("api-host", options("api-host"))
+	clientOptions.BasePath, _ = actions.GetInput("api-base-path", options("api-base-path"))
 
-	logger.Infof(
-		"Beginning upload of the following files: %s.", strings.Join(sourceFiles, ", "),
-	)
+	clientOptions.Scheme, err = actions.GetEnumInput("api-scheme", []string{"http", "https"}, options("api-scheme"))
+	check(err)
+
+	clientOptions.Proxy, _ = actions.GetInput("http-proxy", options("http-proxy"))
+	clientOptions.CABundle, _ = actions.GetInput("ca-bundle", options("ca-bundle"))
+
+	clientOptions.Timeout, err = actions.GetDurationInput("api-timeout", options("api-timeout"))
+	check(err)
 
-	// Create new deploy with additional files.
-	deploy, err = handler.CreateDeployWithFiles(ctx, deployParams)
+	netlifyClient, err := upload.NewClientWithOptions(clientOptions)
 	if err != nil {
-		handleError(ctx, fmt.Errorf("error while initiating new deployment: %w", err), &deploy.ID)
+		check(fmt.Errorf("could not configure Netlify API client: %w", err))
 	}
 
-	logger.Debugf("Started new deploy with ID %s", deploy.ID)
-
-	uploadParams := make([]upload.DeployFileUploadParams, 0, len(destinationPaths))
-	for path, reader := range sourceFileReaders {
-		uploadParams = append(uploadParams, upload.DeployFileUploadParams{
-			DeployID: deploy.ID,
-			Path:     path,
-			File:     reader,
-		})
+	u.handler = upload.Handler{
+		Token:       netlifyToken,
+		Concurrency: concurrency,
+		Retry:       retry,
+		Client:      netlifyClient,
+		Poll:        poll,
+		StateChanged: func(deploy *models.Deploy, previous string) {
+			if previous == "" {
+				logger.Infof("Deploy %s is %s.", deploy.ID, deploy.State)
+				return
+			}
+
+			logger.Infof("Deploy %s changed from %s to %s.", deploy.ID, previous, deploy.State)
+		},
 	}
 
-	// Upload additional files and wait for deploy to finish.
-	files, err = handler.UploadFilesToDeploy(ctx, uploadParams...)
-	if err != nil {
-		for _, fileError := range joinederror.UnwrapAll(err) {
-			logger.Error(fileError.Error())
+	return
+}
+
+// capitalize returns the message with its first letter in upper case.
+func capitalize(message string) string {
+	return regexp.MustCompile(`^\w`).ReplaceAllStringFunc(message, func(s string) string {
+		return strings.ToUpper(s)
+	})
+}
+
+func main() {
+	logger.Debugf(
+		"upload-to-netlify-action %s (commit: %s, compiled: %s)",
+		version, commit, date,
+	)
+
+	u, problems := newUploader()
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			logger.Error(capitalize(problem.Error()))
 		}
 
-		handleError(ctx, errors.New("could not upload files due to the above errors"), &deploy.ID)
+		logger.Errorf("The inputs of the action are invalid, found %d problem(s).", len(problems))
+		os.Exit(1)
 	}
 
-	logger.Debugf("Uploaded %d files to deploy with ID %s", len(files), deploy.ID)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	err = handler.WaitForDeploy(ctx, deploy)
-	if err != nil {
-		handleError(
-			ctx, fmt.Errorf("encountered error waiting for deploy to complete: %w", err), &deploy.ID,
+	if err := u.run(ctx); err != nil {
+		// Log error, but capitalize the first letter. The error is attached to the workflow file so
+		// that it shows up in the annotations of the run.
+		logger.ErrorAnnotation(
+			capitalize(err.Error()),
+			actions.AnnotationProperties{
+				Title: "Upload to Netlify failed",
+				File:  u.githubContext.WorkflowFile(),
+			},
 		)
-	}
 
-	logger.Info("Files successfully uploaded to Netlify!")
+		cancel()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/mrflynn/go-joinederror"
+	"github.com/mrflynn/upload-to-netlify-action/internal/actions"
+	"github.com/mrflynn/upload-to-netlify-action/internal/source"
+	"github.com/mrflynn/upload-to-netlify-action/internal/upload"
+	"github.com/netlify/open-api/v2/go/models"
+)
+
+// uploader uploads files to, or rolls back, a Netlify site according to the inputs of the action.
+type uploader struct {
+	inputs
+	handler upload.Handler
+}
+
+// run looks up the site and then either uploads the source files or rolls back the site.
+func (u *uploader) run(ctx context.Context) (err error) {
+	var site *models.Site
+
+	if u.siteID != "" {
+		site, err = u.handler.GetSiteByID(ctx, u.siteID)
+		if err != nil {
+			err = fmt.Errorf("error getting details for site ID %s: %w", u.siteID, err)
+			return
+		}
+	} else {
+		site, err = u.handler.GetSite(ctx, u.siteName, u.accountSlug)
+		if err != nil {
+			err = fmt.Errorf("error getting details for site %s: %w", u.siteName, err)
+			return
+		}
+	}
+
+	logger.Debugf("Got site ID for %s (ID: %s)", site.Name, site.ID)
+
+	if u.mode == modeRollback {
+		err = u.rollback(ctx, site)
+		return
+	}
+
+	err = u.upload(ctx, site)
+	return
+}
+
+func cleanDestinationPath(path string) (cleaned string, err error) {
+	if regexp.MustCompile("[#?]").MatchString(path) {
+		err = fmt.Errorf("path %s contains one of the following illegal characters: #, ?", path)
+		return
+	}
+
+	cleaned = strings.TrimPrefix(path, "/")
+	return
+}
+
+// resolveSourceFiles expands every source into the paths of the files it refers to, keyed by their
+// destination path. The files are only opened while they are hashed and uploaded, so that large
+// directories do not exhaust the available file descriptors.
+func (u *uploader) resolveSourceFiles() (sources map[string]string, err error) {
+	sources = make(map[string]string, len(u.destinationPaths))
+
+	var (
+		files []source.File
+		dest  string
+	)
+
+	for i, sourceFile := range u.sourceFiles {
+		files, err = source.Resolve(sourceFile, u.destinationPaths[i], u.sourceOptions)
+		if err != nil {
+			err = fmt.Errorf("error reading source %s: %w", sourceFile, err)
+			return
+		}
+
+		for _, f := range files {
+			dest, err = cleanDestinationPath(f.Destination)
+			if err != nil {
+				err = fmt.Errorf("error in destination path %s: %w", f.Destination, err)
+				return
+			}
+
+			if _, ok := sources[dest]; ok {
+				err = fmt.Errorf("destination path %s is used by more than one source file", f.Destination)
+				return
+			}
+
+			sources[dest] = f.Source
+		}
+	}
+
+	return
+}
+
+// deletePathMatcher returns a function that matches site paths against a single delete-path entry.
+// Entries ending in a slash match everything underneath that directory, glob patterns are matched
+// with source.Match, and anything else must match exactly. Glob patterns also match a path equal to
+// them, so that files with metacharacters in their name such as "/out/[slug].html" can be deleted.
+func deletePathMatcher(entry string) func(path string) bool {
+	entry = "/" + strings.TrimPrefix(entry, "/")
+
+	switch {
+	case source.IsPattern(entry):
+		return func(path string) bool {
+			return path == entry || source.Match(entry, path)
+		}
+	case strings.HasSuffix(entry, "/"):
+		return func(path string) bool {
+			return strings.HasPrefix(path, entry)
+		}
+	default:
+		return func(path string) bool {
+			return path == entry
+		}
+	}
+}
+
+func (u *uploader) removeDeletedPaths(deployParams *upload.DeployWithFilesParams) {
+	for _, entry := range u.deletePaths {
+		if entry == "" {
+			continue
+		}
+
+		removed := deployParams.RemoveFiles(deletePathMatcher(entry))
+		if len(removed) == 0 {
+			logger.Warnf("Delete path %s did not match any files on the site", entry)
+			continue
+		}
+
+		for _, path := range removed {
+			logger.Infof("Removing %s from the site (matched %s).", path, entry)
+		}
+	}
+}
+
+// pruneSyncedPaths removes every file on the site that lives under the destination of a directory or
+// glob source, but that is not part of the files being uploaded from that source. For glob sources,
+// only files that the pattern could have produced are removed.
+func (u *uploader) pruneSyncedPaths(deployParams *upload.DeployWithFilesParams, sources map[string]string) (err error) {
+	for i, sourceFile := range u.sourceFiles {
+		isPattern := source.IsGlob(sourceFile)
+
+		if !isPattern {
+			var info os.FileInfo
+			info, err = os.Stat(sourceFile)
+			if err != nil {
+				return
+			}
+
+			if !info.IsDir() {
+				logger.Debugf("Not syncing %s because it is a single file", sourceFile)
+				continue
+			}
+		}
+
+		var prefix string
+		prefix, err = cleanDestinationPath(u.destinationPaths[i])
+		if err != nil {
+			return
+		}
+
+		if prefix = "/" + strings.TrimSuffix(prefix, "/"); prefix != "/" {
+			prefix += "/"
+		}
+
+		removed := deployParams.RemoveFiles(func(path string) bool {
+			if _, ok := sources[strings.TrimPrefix(path, "/")]; ok || !strings.HasPrefix(path, prefix) {
+				return false
+			}
+
+			return !isPattern || source.MatchRelative(sourceFile, strings.TrimPrefix(path, prefix))
+		})
+
+		for _, path := range removed {
+			logger.Infof("Removing %s from the site (not present in %s).", path, sourceFile)
+		}
+	}
+
+	return
+}
+
+// registerSourceFile adds the local file at sourcePath to the deploy under path. The file is only kept
+// open while it is hashed.
+func registerSourceFile(deployParams *upload.DeployWithFilesParams, path, sourcePath string) (err error) {
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	err = deployParams.RegisterFile(path, file)
+	return
+}
+
+// openSourceFile returns a function that opens the local file at sourcePath for uploading.
+func openSourceFile(sourcePath string) func() (io.ReadSeekCloser, error) {
+	return func() (io.ReadSeekCloser, error) {
+		return os.Open(sourcePath)
+	}
+}
+
+// titleData contains the values available to the deploy-title template.
+type titleData struct {
+	actions.Context
+	Branch string
+}
+
+// parseDeployTitle parses the deploy-title template and renders it once with data, so that fields
+// that do not exist are reported along with the other problems of the inputs.
+func parseDeployTitle(text string, data titleData) (tmpl *template.Template, err error) {
+	tmpl, err = template.New("deploy-title").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return
+	}
+
+	if err = tmpl.Execute(io.Discard, data); err != nil {
+		tmpl = nil
+	}
+
+	return
+}
+
+func (u *uploader) createDeployTitle() (title string, err error) {
+	var b strings.Builder
+
+	err = u.titleTemplate.Execute(&b, titleData{Context: u.githubContext, Branch: u.branchName})
+	if err != nil {
+		err = fmt.Errorf("error rendering deploy title: %w", err)
+		return
+	}
+
+	title = b.String()
+	return
+}
+
+// getBaseDeploy returns the deploy whose files the new deploy starts from. A nil deploy means the new
+// deploy starts without any files.
+func (u *uploader) getBaseDeploy(ctx context.Context, site *models.Site) (base *models.Deploy, err error) {
+	if u.baseDeployID != "" {
+		base, err = u.handler.GetDeploy(ctx, site.ID, u.baseDeployID)
+		if err != nil {
+			err = fmt.Errorf("error getting base deploy %s: %w", u.baseDeployID, err)
+		}
+
+		return
+	}
+
+	var deploys []*models.Deploy
+	deploys, err = u.handler.ListDeploys(ctx, site.ID, u.branchName)
+	if err != nil {
+		err = fmt.Errorf("error listing deploys: %w", err)
+		return
+	}
+
+	base, err = u.selectReadyDeploy(ctx, site.ID, deploys)
+	if !errors.Is(err, upload.ErrNoDeploys) {
+		return
+	}
+
+	switch u.baseFallback {
+	case fallbackEmpty:
+		logger.Infof("Branch %s does not have any deploys yet, starting without any files.", u.branchName)
+		base, err = nil, nil
+	case fallbackProduction:
+		if site.PublishedDeploy == nil {
+			err = fmt.Errorf("branch %s does not have any deploys and the site is not published", u.branchName)
+			return
+		}
+
+		logger.Infof(
+			"Branch %s does not have any deploys yet, starting from production deploy %s.",
+			u.branchName, site.PublishedDeploy.ID,
+		)
+
+		base, err = site.PublishedDeploy, nil
+	default:
+		err = fmt.Errorf(
+			"%w (set base-fallback to %s or %s to create the first deploy)", err, fallbackEmpty, fallbackProduction,
+		)
+	}
+
+	return
+}
+
+// prepareDeploy waits for the base deploy to complete and returns the parameters of a deploy that
+// applies the source files, deletions, and sync to the files and functions of the base deploy.
+func (u *uploader) prepareDeploy(
+	ctx context.Context, site *models.Site, base *models.Deploy, sources map[string]string,
+) (deployParams *upload.DeployWithFilesParams, err error) {
+	var files []*models.File
+
+	logger.Group("Preparing deploy")
+	defer logger.EndGroup()
+
+	if base != nil {
+		logger.Debugf("Using deploy %s as the base for the new deploy", base.ID)
+
+		_, err = u.handler.WaitForDeploy(ctx, base)
+		if err != nil {
+			err = fmt.Errorf("encountered error waiting for deploy to complete: %w", err)
+			return
+		}
+
+		// Get the files of the base deploy.
+		files, err = u.handler.GetDeployFiles(ctx, base.ID)
+		if err != nil {
+			err = fmt.Errorf("error getting files for deploy %s: %w", base.ID, err)
+			return
+		}
+
+		logger.Debugf("Got %d preexisting files from deploy ID %s", len(files), base.ID)
+	}
+
+	deployParams = upload.NewDeployWithExistingFiles(site.ID, u.branchName, files)
+	u.removeDeletedPaths(deployParams)
+
+	if u.syncMode {
+		err = u.pruneSyncedPaths(deployParams, sources)
+		if err != nil {
+			err = fmt.Errorf("error while syncing files: %w", err)
+			return
+		}
+	}
+
+	for path, sourcePath := range sources {
+		err = registerSourceFile(deployParams, "/"+path, sourcePath)
+		if err != nil {
+			err = fmt.Errorf("error preparing file %s for upload: %w", path, err)
+			return
+		}
+
+		logger.Debugf("Registered file %s", path)
+	}
+
+	deployParams.Title, err = u.createDeployTitle()
+	if err != nil {
+		return
+	}
+
+	deployParams.Draft = u.draftMode
+	deployParams.CommitRef = u.githubContext.SHA
+
+	// Link the deploy to the workflow run that made it, or at least to the commit it was made from.
+	if deployParams.CommitURL = u.githubContext.RunURL(); deployParams.CommitURL == "" {
+		deployParams.CommitURL = u.githubContext.CommitURL()
+	}
+
+	// Keep the functions of the previous deploy, since they cannot be uploaded by this action.
+	if base != nil {
+		var functions *upload.DeployFunctions
+		functions, err = u.handler.GetDeployFunctions(ctx, base)
+		if err != nil {
+			err = fmt.Errorf("error getting functions of deploy %s: %w", base.ID, err)
+			return
+		}
+
+		err = deployParams.CarryForwardFunctions(base, functions)
+		if err != nil {
+			err = fmt.Errorf("refusing to create a deploy that would drop functions: %w", err)
+			return
+		}
+
+		logger.Debugf("Carrying forward %d functions from deploy %s", len(deployParams.Functions), base.ID)
+	}
+
+	return
+}
+
+// selectReadyDeploy returns the newest ready deploy of the branch. If a newer deploy is being built,
+// it is waited on and used instead unless it fails or does not finish in time.
+func (u *uploader) selectReadyDeploy(ctx context.Context, siteID string, deploys []*models.Deploy) (base *models.Deploy, err error) {
+	base, pending := upload.SelectBaseDeploy(deploys)
+
+	for _, d := range deploys {
+		if d == base {
+			break
+		}
+
+		if d.State == "error" {
+			logger.Infof("Skipping deploy %s because it failed: %s", d.ID, d.ErrorMessage)
+		}
+	}
+
+	if pending != nil {
+		logger.Infof("Deploy %s is %s, waiting for it to finish.", pending.ID, pending.State)
+
+		var (
+			ready     *models.Deploy
+			deployErr *upload.DeployError
+		)
+
+		ready, err = u.handler.WaitForDeploy(ctx, pending)
+		switch {
+		case err == nil:
+			logger.Infof("Using deploy %s as the base because it finished building.", ready.ID)
+			base = ready
+			return
+		case errors.As(err, &deployErr):
+			logger.Infof("Skipping deploy %s because it failed: %s", pending.ID, deployErr.Message)
+			err = nil
+		case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+			logger.Warnf("Skipping deploy %s because it did not finish building: %s", pending.ID, err)
+			err = nil
+		default:
+			err = fmt.Errorf("encountered error waiting for deploy to complete: %w", err)
+			return
+		}
+	}
+
+	if base == nil {
+		err = fmt.Errorf("%w in the ready state for site_id:%s branch:%s", upload.ErrNoDeploys, siteID, u.branchName)
+		return
+	}
+
+	logger.Infof("Using deploy %s as the base because it is the newest ready deploy.", base.ID)
+	return
+}
+
+// preferSSL returns the HTTPS variant of a URL if Netlify provided one.
+func preferSSL(ssl, plain string) string {
+	if ssl != "" {
+		return ssl
+	}
+
+	return plain
+}
+
+// productionBranch returns the branch whose deploys are served from the main URL of the site. It is
+// the branch configured in the build settings of the site, or else the branch of the published deploy.
+func productionBranch(site *models.Site) string {
+	if site.BuildSettings != nil && site.BuildSettings.RepoBranch != "" {
+		return site.BuildSettings.RepoBranch
+	}
+
+	if site.PublishedDeploy != nil {
+		return site.PublishedDeploy.Branch
+	}
+
+	return ""
+}
+
+// deployURLs returns the URL the deploy is served from and its permalink.
+func (u *uploader) deployURLs(site *models.Site, deploy *models.Deploy) (deployURL, permalink string) {
+	permalink = preferSSL(deploy.DeploySslURL, deploy.DeployURL)
+	deployURL = preferSSL(deploy.SslURL, deploy.URL)
+
+	// The URL of a deploy is the main URL of the site, which only serves the production branch. Drafts
+	// and deploys of other branches are only certain to be served from their permalink.
+	if u.draftMode || deployURL == "" || u.branchName != productionBranch(site) {
+		deployURL = permalink
+	}
+
+	return
+}
+
+// setOutputs publishes the results of the upload as step outputs.
+func (u *uploader) setOutputs(site *models.Site, deploy *models.Deploy, uploaded []string, skipped int) {
+	deployURL, permalink := u.deployURLs(site, deploy)
+
+	sort.Strings(uploaded)
+
+	urls := make([]string, 0, len(uploaded))
+	for _, path := range uploaded {
+		urls = append(urls, strings.TrimSuffix(deployURL, "/")+"/"+path)
+	}
+
+	outputs := []struct{ name, value string }{
+		{"deploy-id", deploy.ID},
+		{"deploy-url", deployURL},
+		{"permalink", permalink},
+		{"site-url", preferSSL(site.SslURL, site.URL)},
+		{"uploaded-urls", strings.Join(urls, "\n")},
+		{"skipped-files", strconv.Itoa(skipped)},
+	}
+
+	for _, output := range outputs {
+		if err := actions.SetOutput(output.name, output.value); err != nil {
+			logger.Warnf("Could not set output %s: %s", output.name, err)
+		}
+	}
+}
+
+// writeSummary adds a report of the deploy and every source file to the job summary.
+func (u *uploader) writeSummary(
+	site *models.Site,
+	deploy *models.Deploy,
+	deployParams *upload.DeployWithFilesParams,
+	sources map[string]string,
+	uploaded []string,
+) {
+	deployURL, permalink := u.deployURLs(site, deploy)
+
+	isUploaded := make(map[string]bool, len(uploaded))
+	for _, path := range uploaded {
+		isUploaded[path] = true
+	}
+
+	destinations := make([]string, 0, len(sources))
+	for dest := range sources {
+		destinations = append(destinations, dest)
+	}
+
+	sort.Strings(destinations)
+
+	rows := make([][]string, 0, len(destinations))
+	for _, dest := range destinations {
+		size := "unknown"
+		if info, err := os.Stat(sources[dest]); err == nil {
+			size = fmt.Sprintf("%d bytes", info.Size())
+		}
+
+		status := "already present"
+		if isUploaded[dest] {
+			status = "uploaded"
+		}
+
+		rows = append(rows, []string{
+			actions.Code(sources[dest]),
+			actions.Link("/"+dest, strings.TrimSuffix(deployURL, "/")+"/"+dest),
+			size,
+			actions.Code(deployParams.Files["/"+dest]),
+			status,
+		})
+	}
+
+	summary := actions.NewSummary().
+		Heading(2, "Netlify Upload").
+		List(
+			"Site: "+actions.Link(site.Name, preferSSL(site.SslURL, site.URL)),
+			"Branch: "+actions.Code(u.branchName),
+			"Deploy: "+actions.Link(deploy.ID, permalink),
+		).
+		Table([]string{"Source", "Destination", "Size", "SHA1", "Status"}, rows)
+
+	if err := summary.Write(); err != nil {
+		logger.Warnf("Could not write job summary: %s", err)
+	}
+}
+
+// rollback restores an earlier deploy of the branch and waits until it is published.
+func (u *uploader) rollback(ctx context.Context, site *models.Site) (err error) {
+	deploys, err := u.handler.ListDeploys(ctx, site.ID, u.branchName)
+	if err != nil {
+		err = fmt.Errorf("error listing deploys: %w", err)
+		return
+	}
+
+	var publishedID string
+	if site.PublishedDeploy != nil {
+		publishedID = site.PublishedDeploy.ID
+	}
+
+	target, err := upload.SelectRollbackDeploy(deploys, publishedID, u.rollbackTarget)
+	if err != nil {
+		return
+	}
+
+	logger.Infof("Rolling back to deploy %s (%s).", target.ID, target.Title)
+
+	_, err = u.handler.RestoreDeploy(ctx, site.ID, target.ID)
+	if err != nil {
+		err = fmt.Errorf("error restoring deploy %s: %w", target.ID, err)
+		return
+	}
+
+	_, err = u.handler.WaitForPublishedDeploy(ctx, site.ID, target.ID)
+	if err != nil {
+		err = fmt.Errorf("encountered error waiting for deploy to go live: %w", err)
+		return
+	}
+
+	logger.Infof("Deploy %s has been restored!", target.ID)
+	return
+}
+
+// upload creates a deploy of the site with the source files on top of the files of the base deploy
+// and waits for it to become ready. If anything fails after the deploy was created, it is destroyed.
+func (u *uploader) upload(ctx context.Context, site *models.Site) (err error) {
+	// Get the deploy to base the new deploy on.
+	base, err := u.getBaseDeploy(ctx, site)
+	if err != nil {
+		return
+	}
+
+	sourcePaths, err := u.resolveSourceFiles()
+	if err != nil {
+		return
+	}
+
+	logger.Infof(
+		"Beginning upload of the following files: %s.", strings.Join(u.sourceFiles, ", "),
+	)
+
+	var (
+		deployParams *upload.DeployWithFilesParams
+		deploy       *models.Deploy
+
+		// created is the ID of a deploy that has to be destroyed if the upload fails.
+		created string
+	)
+
+	defer func() {
+		if err == nil || created == "" {
+			return
+		}
+
+		if destroyErr := u.handler.DestroyDeploy(ctx, created); destroyErr != nil {
+			logger.Errorf("Error while trying to destroy deploy: %s", destroyErr)
+		}
+	}()
+
+	for attempt := 0; ; attempt++ {
+		deployParams, err = u.prepareDeploy(ctx, site, base, sourcePaths)
+		if err != nil {
+			return
+		}
+
+		// Create new deploy with additional files.
+		deploy, err = u.handler.CreateDeployWithFiles(ctx, deployParams)
+		if deploy != nil {
+			created = deploy.ID
+		}
+
+		if err != nil {
+			err = fmt.Errorf("error while initiating new deployment: %w", err)
+			return
+		}
+
+		// A base deploy given by the user is never replaced.
+		if u.baseDeployID != "" {
+			break
+		}
+
+		// Another deploy on the branch may have been created since the base deploy was read. Publishing
+		// this deploy would then drop its files, so rebase onto it instead.
+		var baseID string
+		if base != nil {
+			baseID = base.ID
+		}
+
+		var conflict *models.Deploy
+		conflict, err = u.handler.FindConflictingDeploy(ctx, site.ID, u.branchName, baseID, deploy.ID)
+		if err != nil {
+			err = fmt.Errorf("error checking for concurrent deploys: %w", err)
+			return
+		}
+
+		if conflict == nil {
+			break
+		}
+
+		if attempt >= u.conflictRetries {
+			err = fmt.Errorf(
+				"deploy %s was created on branch %s while this deploy was being prepared, giving up after %d attempts",
+				conflict.ID, u.branchName, attempt+1,
+			)
+
+			return
+		}
+
+		logger.Warnf(
+			"Deploy %s was created on branch %s while this deploy was being prepared, rebasing onto it.",
+			conflict.ID, u.branchName,
+		)
+
+		if err = u.handler.DestroyDeploy(ctx, deploy.ID); err != nil {
+			err = fmt.Errorf("error while discarding outdated deploy %s: %w", deploy.ID, err)
+			created = ""
+
+			return
+		}
+
+		base, created = conflict, ""
+	}
+
+	logger.Debugf("Started new deploy with ID %s", deploy.ID)
+
+	logger.Group("Uploading files")
+
+	paths := make([]string, 0, len(sourcePaths))
+	for path := range sourcePaths {
+		paths = append(paths, "/"+path)
+	}
+
+	required, skippedPaths := deployParams.RequiredFiles(deploy, paths)
+	for _, path := range skippedPaths {
+		if deployParams.IsRequired(deploy, path) {
+			logger.Infof("Skipping upload of %s, a file with the same contents is uploaded instead.", path)
+		} else {
+			logger.Infof("Skipping upload of %s, Netlify already has its contents.", path)
+		}
+	}
+
+	skipped := len(skippedPaths)
+
+	uploadParams := make([]upload.DeployFileUploadParams, 0, len(required))
+	for _, path := range required {
+		path = strings.TrimPrefix(path, "/")
+
+		uploadParams = append(uploadParams, upload.DeployFileUploadParams{
+			DeployID: deploy.ID,
+			Path:     path,
+			Open:     openSourceFile(sourcePaths[path]),
+		})
+	}
+
+	// Upload additional files and wait for deploy to finish.
+	files, err := u.handler.UploadFilesToDeploy(ctx, uploadParams...)
+	if err != nil {
+		for _, fileError := range joinederror.UnwrapAll(err) {
+			logger.Error(fileError.Error())
+		}
+
+		logger.EndGroup()
+
+		err = errors.New("could not upload files due to the above errors")
+		return
+	}
+
+	logger.Debugf("Uploaded %d files to deploy with ID %s", len(files), deploy.ID)
+	logger.EndGroup()
+
+	ready, err := u.handler.WaitForDeploy(ctx, deploy)
+	if err != nil {
+		err = fmt.Errorf("encountered error waiting for deploy to complete: %w", err)
+		return
+	}
+
+	uploaded := make([]string, 0, len(uploadParams))
+	for _, params := range uploadParams {
+		uploaded = append(uploaded, params.Path)
+	}
+
+	u.setOutputs(site, ready, uploaded, skipped)
+	u.writeSummary(site, ready, deployParams, sourcePaths, uploaded)
+
+	if u.draftMode {
+		_, permalink := u.deployURLs(site, ready)
+		logger.Infof("Draft deploy is ready for review at %s", permalink)
+		return
+	}
+
+	logger.Info("Files successfully uploaded to Netlify!")
+	return
+}
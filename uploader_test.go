@@ -0,0 +1,643 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mrflynn/upload-to-netlify-action/internal/actions"
+	"github.com/mrflynn/upload-to-netlify-action/internal/netlifytest"
+	"github.com/mrflynn/upload-to-netlify-action/internal/upload"
+	"github.com/netlify/open-api/v2/go/models"
+)
+
+// newTestUploader returns an uploader for the site named docs on the given fake server, with the
+// default inputs of the action. Step outputs and the job summary are written to temporary files.
+func newTestUploader(t *testing.T) (*uploader, *netlifytest.Server) {
+	t.Helper()
+
+	server := netlifytest.NewServer(t)
+
+	output := logger.Output
+	logger.Output = io.Discard
+	t.Cleanup(func() { logger.Output = output })
+
+	dir := t.TempDir()
+	t.Setenv("GITHUB_OUTPUT", filepath.Join(dir, "output"))
+	t.Setenv("GITHUB_STEP_SUMMARY", filepath.Join(dir, "summary"))
+
+	return &uploader{
+		inputs: inputs{
+			mode:            modeUpload,
+			siteName:        "docs",
+			branchName:      "main",
+			baseFallback:    fallbackFail,
+			conflictRetries: 3,
+			githubContext: actions.Context{
+				ServerURL:  "https://github.com",
+				Repository: "octocat/docs",
+				SHA:        "1a2b3c4d5e6f",
+				RunID:      "42",
+			},
+			titleTemplate: template.Must(template.New("deploy-title").Parse("{{ .Branch }}@{{ .ShortSHA }}")),
+		},
+		handler: upload.Handler{
+			Concurrency: 2,
+			Retry:       upload.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			Poll:        upload.PollPolicy{Interval: time.Millisecond, MaxInterval: 4 * time.Millisecond},
+			Client:      upload.NewClient(server.Transport()),
+		},
+	}, server
+}
+
+// writeSources creates a directory with the given file contents, keyed by slash separated paths.
+func writeSources(t *testing.T, files map[string]string) (dir string) {
+	t.Helper()
+
+	dir = t.TempDir()
+	for p, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(p))
+
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return
+}
+
+func hash(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func latestDeploy(t *testing.T, u *uploader, site *models.Site) *models.Deploy {
+	t.Helper()
+
+	deploys, err := u.handler.ListDeploys(context.Background(), site.ID, u.branchName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deploys) == 0 {
+		t.Fatalf("Expected a deploy of branch %s", u.branchName)
+	}
+
+	return deploys[0]
+}
+
+func TestUploader_Run(t *testing.T) {
+	u, server := newTestUploader(t)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, map[string][]byte{
+		"/index.html":   []byte("index"),
+		"/docs/old.txt": []byte("old"),
+	})
+
+	u.sourceFiles = []string{writeSources(t, map[string]string{
+		"guide.txt": "guide",
+		"copy.html": "index",
+	})}
+
+	u.destinationPaths = []string{"/docs"}
+
+	if err := u.run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	deploy := latestDeploy(t, u, site)
+
+	if diff := cmp.Diff(
+		[]string{"ready", "main@1a2b3c4", "https://github.com/octocat/docs/actions/runs/42"},
+		[]string{deploy.State, deploy.Title, deploy.CommitURL},
+	); diff != "" {
+		t.Errorf("Deploy mismatch (-want +got):\n%s", diff)
+	}
+
+	expected := map[string]string{
+		"/index.html":     hash("index"),
+		"/docs/old.txt":   hash("old"),
+		"/docs/guide.txt": hash("guide"),
+		"/docs/copy.html": hash("index"),
+	}
+
+	if diff := cmp.Diff(expected, server.DeployFiles(deploy.ID)); diff != "" {
+		t.Errorf("Deploy files mismatch (-want +got):\n%s", diff)
+	}
+
+	outputs, err := os.ReadFile(os.Getenv("GITHUB_OUTPUT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"deploy-id=" + deploy.ID + "\n", "skipped-files=1\n"} {
+		if !strings.Contains(string(outputs), expected) {
+			t.Errorf("Expected outputs to contain %q, got:\n%s", expected, outputs)
+		}
+	}
+
+	summary, err := os.ReadFile(os.Getenv("GITHUB_STEP_SUMMARY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{hash("guide") + "` | uploaded |", hash("index") + "` | already present |"} {
+		if !strings.Contains(string(summary), expected) {
+			t.Errorf("Expected summary to contain %q, got:\n%s", expected, summary)
+		}
+	}
+}
+
+func TestUploader_Run_DuplicateContents(t *testing.T) {
+	u, server := newTestUploader(t)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+
+	u.sourceFiles = []string{writeSources(t, map[string]string{
+		"en/logo.svg": "logo",
+		"fr/logo.svg": "logo",
+		"de/logo.svg": "logo",
+	})}
+
+	u.destinationPaths = []string{"/"}
+
+	if err := u.run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		"/de/logo.svg": hash("logo"),
+		"/en/logo.svg": hash("logo"),
+		"/fr/logo.svg": hash("logo"),
+	}
+
+	if diff := cmp.Diff(expected, server.DeployFiles(latestDeploy(t, u, site).ID)); diff != "" {
+		t.Errorf("Deploy files mismatch (-want +got):\n%s", diff)
+	}
+
+	outputs, err := os.ReadFile(os.Getenv("GITHUB_OUTPUT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(outputs), "skipped-files=2\n") {
+		t.Errorf("Expected two skipped files, got:\n%s", outputs)
+	}
+}
+
+func Test_deletePathMatcher(t *testing.T) {
+	testCases := []struct {
+		entry  string
+		path   string
+		result bool
+	}{
+		{entry: "/old/report.pdf", path: "/old/report.pdf", result: true},
+		{entry: "old/report.pdf", path: "/old/report.pdf", result: true},
+		{entry: "/old/report.pdf", path: "/old/report.pdf.bak", result: false},
+		{entry: "/reports/2022/", path: "/reports/2022/q1.pdf", result: true},
+		{entry: "/reports/2022/", path: "/reports/2022.pdf", result: false},
+		{entry: "/docs/**/*-draft.pdf", path: "/docs/v1/guide-draft.pdf", result: true},
+		{entry: "/docs/**/*-draft.pdf", path: "/docs/v1/guide.pdf", result: false},
+		{entry: "/out/[slug].html", path: "/out/[slug].html", result: true},
+		{entry: "/out/[slug].html", path: "/out/s.html", result: true},
+		{entry: "/out/[slug].html", path: "/out/post.html", result: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.entry+"_"+tc.path, func(t *testing.T) {
+			if result := deletePathMatcher(tc.entry)(tc.path); result != tc.result {
+				t.Errorf("deletePathMatcher(%q)(%q) = %t, want %t", tc.entry, tc.path, result, tc.result)
+			}
+		})
+	}
+}
+
+func TestUploader_RemoveDeletedPaths(t *testing.T) {
+	u, _ := newTestUploader(t)
+	u.deletePaths = []string{"/old/report.pdf", "/reports/2022/", "", "/docs/**/*-draft.pdf", "/missing.txt"}
+
+	params := &upload.DeployWithFilesParams{Files: map[string]string{
+		"/index.html":              "1",
+		"/old/report.pdf":          "2",
+		"/reports/2022/q1.pdf":     "3",
+		"/reports/2023/q1.pdf":     "4",
+		"/docs/v1/guide-draft.pdf": "5",
+		"/docs/v1/guide.pdf":       "6",
+	}}
+
+	u.removeDeletedPaths(params)
+
+	expected := map[string]string{
+		"/index.html":          "1",
+		"/reports/2023/q1.pdf": "4",
+		"/docs/v1/guide.pdf":   "6",
+	}
+
+	if diff := cmp.Diff(expected, params.Files); diff != "" {
+		t.Errorf("Files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploader_PruneSyncedPaths(t *testing.T) {
+	root := writeSources(t, map[string]string{
+		"coverage/index.html": "index",
+		"reports/new.pdf":     "new",
+		"README.md":           "readme",
+	})
+
+	testCases := []struct {
+		name        string
+		source      string
+		destination string
+		removed     []string
+	}{
+		{
+			name:        "directory",
+			source:      filepath.Join(root, "coverage"),
+			destination: "/coverage",
+			removed:     []string{"/coverage/old.html"},
+		},
+		{
+			name:        "glob",
+			source:      filepath.ToSlash(root) + "/reports/*.pdf",
+			destination: "/",
+			removed:     []string{"/old.pdf"},
+		},
+		{
+			name:        "single_file",
+			source:      filepath.Join(root, "README.md"),
+			destination: "/README.md",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, _ := newTestUploader(t)
+			u.sourceFiles, u.destinationPaths = []string{tc.source}, []string{tc.destination}
+
+			sources, err := u.resolveSourceFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			params := &upload.DeployWithFilesParams{Files: map[string]string{
+				"/coverage/index.html": "1",
+				"/coverage/old.html":   "2",
+				"/new.pdf":             "3",
+				"/old.pdf":             "4",
+				"/index.html":          "5",
+				"/archive/old.pdf":     "6",
+			}}
+
+			if err = u.pruneSyncedPaths(params, sources); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			var removed []string
+			for _, path := range []string{
+				"/coverage/index.html", "/coverage/old.html", "/new.pdf", "/old.pdf", "/index.html", "/archive/old.pdf",
+			} {
+				if _, ok := params.Files[path]; !ok {
+					removed = append(removed, path)
+				}
+			}
+
+			if diff := cmp.Diff(tc.removed, removed); diff != "" {
+				t.Errorf("Removed files mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseDeployTitle(t *testing.T) {
+	data := titleData{Context: actions.Context{SHA: "1a2b3c4d5e6f"}, Branch: "main"}
+
+	testCases := []struct {
+		name    string
+		text    string
+		errored bool
+	}{
+		{name: "valid", text: "{{ .Branch }}@{{ .ShortSHA }}"},
+		{name: "syntax_error", text: "{{ .Branch ", errored: true},
+		{name: "unknown_field", text: "{{ .RunUrl }}", errored: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseDeployTitle(tc.text, data)
+			if tc.errored != (err != nil) {
+				t.Errorf("Expected error: %t, got: %v", tc.errored, err)
+			}
+		})
+	}
+}
+
+func TestUploader_deployURLs(t *testing.T) {
+	var (
+		deploy = &models.Deploy{
+			SslURL:       "https://docs.netlify.app",
+			DeploySslURL: "https://1234--docs.netlify.app",
+		}
+
+		published  = &models.Site{PublishedDeploy: &models.Deploy{Branch: "main"}}
+		configured = &models.Site{
+			BuildSettings:   &models.RepoInfo{RepoBranch: "main"},
+			PublishedDeploy: &models.Deploy{Branch: "staging"},
+		}
+	)
+
+	testCases := []struct {
+		name      string
+		draft     bool
+		branch    string
+		site      *models.Site
+		deploy    *models.Deploy
+		deployURL string
+		permalink string
+	}{
+		{
+			name:      "production",
+			branch:    "main",
+			site:      published,
+			deploy:    deploy,
+			deployURL: "https://docs.netlify.app",
+			permalink: "https://1234--docs.netlify.app",
+		},
+		{
+			name:      "production_from_build_settings",
+			branch:    "main",
+			site:      configured,
+			deploy:    deploy,
+			deployURL: "https://docs.netlify.app",
+			permalink: "https://1234--docs.netlify.app",
+		},
+		{
+			name:      "branch",
+			branch:    "staging",
+			site:      published,
+			deploy:    deploy,
+			deployURL: "https://1234--docs.netlify.app",
+			permalink: "https://1234--docs.netlify.app",
+		},
+		{
+			name:      "branch_from_build_settings",
+			branch:    "staging",
+			site:      configured,
+			deploy:    deploy,
+			deployURL: "https://1234--docs.netlify.app",
+			permalink: "https://1234--docs.netlify.app",
+		},
+		{
+			name:      "no_production_branch",
+			branch:    "main",
+			site:      &models.Site{},
+			deploy:    deploy,
+			deployURL: "https://1234--docs.netlify.app",
+			permalink: "https://1234--docs.netlify.app",
+		},
+		{
+			name:      "draft",
+			draft:     true,
+			branch:    "main",
+			site:      published,
+			deploy:    deploy,
+			deployURL: "https://1234--docs.netlify.app",
+			permalink: "https://1234--docs.netlify.app",
+		},
+		{
+			name:      "draft_without_ssl",
+			draft:     true,
+			branch:    "main",
+			site:      published,
+			deploy:    &models.Deploy{DeployURL: "http://1234--docs.netlify.app"},
+			deployURL: "http://1234--docs.netlify.app",
+			permalink: "http://1234--docs.netlify.app",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &uploader{inputs: inputs{branchName: tc.branch, draftMode: tc.draft}}
+
+			deployURL, permalink := u.deployURLs(tc.site, tc.deploy)
+			if diff := cmp.Diff([]string{tc.deployURL, tc.permalink}, []string{deployURL, permalink}); diff != "" {
+				t.Errorf("URLs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUploader_GetBaseDeploy(t *testing.T) {
+	u, server := newTestUploader(t)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	production := server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "staging", State: "error"}, nil)
+
+	site, err := u.handler.GetSiteByID(context.Background(), site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		branch   string
+		fallback string
+		base     string
+		errored  bool
+	}{
+		{name: "newest_ready", branch: "main", fallback: fallbackFail, base: production.ID},
+		{name: "fallback_fail", branch: "staging", fallback: fallbackFail, errored: true},
+		{name: "fallback_empty", branch: "staging", fallback: fallbackEmpty},
+		{name: "fallback_production", branch: "staging", fallback: fallbackProduction, base: production.ID},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u.branchName, u.baseFallback = tc.branch, tc.fallback
+
+			base, err := u.getBaseDeploy(context.Background(), site)
+			if tc.errored {
+				if !errors.Is(err, upload.ErrNoDeploys) {
+					t.Errorf("Expected ErrNoDeploys, got: %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			var id string
+			if base != nil {
+				id = base.ID
+			}
+
+			if diff := cmp.Diff(tc.base, id); diff != "" {
+				t.Errorf("Base deploy mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUploader_GetBaseDeploy_StuckBuild(t *testing.T) {
+	u, server := newTestUploader(t)
+	u.handler.Poll.Timeout = 20 * time.Millisecond
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	ready := server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "building"}, nil)
+
+	// A build that does not finish in time is skipped in favor of the newest ready deploy.
+	base, err := u.getBaseDeploy(context.Background(), site)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(ready.ID, base.ID); diff != "" {
+		t.Errorf("Base deploy mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploader_GetBaseDeploy_PollError(t *testing.T) {
+	u, server := newTestUploader(t)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+	building := server.AddDeploy(site.ID, &models.Deploy{Branch: "main", State: "building"}, nil)
+
+	server.FailRequests(http.MethodGet, "/sites/"+site.ID+"/deploys/"+building.ID, 1, http.StatusUnauthorized, nil)
+
+	// Only a timeout falls back to the older ready deploy. Other errors stop the action.
+	if _, err := u.getBaseDeploy(context.Background(), site); err == nil {
+		t.Error("Expected an error when polling the building deploy fails")
+	}
+}
+
+// addDeployWhileWaiting adds a ready deploy of the branch with the given files the first time the
+// uploader waits on a deploy, which happens after it read the deploys of the branch.
+func addDeployWhileWaiting(u *uploader, server *netlifytest.Server, site *models.Site, files map[string][]byte) {
+	var once sync.Once
+
+	u.handler.StateChanged = func(*models.Deploy, string) {
+		once.Do(func() {
+			server.AddDeploy(site.ID, &models.Deploy{Branch: u.branchName}, files)
+		})
+	}
+}
+
+func TestUploader_Run_Rebase(t *testing.T) {
+	u, server := newTestUploader(t)
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, map[string][]byte{
+		"/index.html": []byte("index"),
+	})
+
+	addDeployWhileWaiting(u, server, site, map[string][]byte{
+		"/index.html":      []byte("index"),
+		"/concurrent.html": []byte("concurrent"),
+	})
+
+	u.sourceFiles = []string{writeSources(t, map[string]string{"report.pdf": "report"})}
+	u.destinationPaths = []string{"/"}
+
+	if err := u.run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		"/index.html":      hash("index"),
+		"/concurrent.html": hash("concurrent"),
+		"/report.pdf":      hash("report"),
+	}
+
+	if diff := cmp.Diff(expected, server.DeployFiles(latestDeploy(t, u, site).ID)); diff != "" {
+		t.Errorf("Deploy files mismatch (-want +got):\n%s", diff)
+	}
+
+	// The deploy made before rebasing is discarded.
+	deploys, err := u.handler.ListDeploys(context.Background(), site.ID, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(3, len(deploys)); diff != "" {
+		t.Errorf("Deploy count mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploader_Run_RebaseRetriesExhausted(t *testing.T) {
+	u, server := newTestUploader(t)
+	u.conflictRetries = 0
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+	addDeployWhileWaiting(u, server, site, nil)
+
+	u.sourceFiles = []string{writeSources(t, map[string]string{"report.pdf": "report"})}
+	u.destinationPaths = []string{"/"}
+
+	if err := u.run(context.Background()); err == nil {
+		t.Fatal("Expected an error after running out of conflict retries")
+	}
+
+	// The deploy that conflicts is destroyed rather than left behind.
+	deploys, err := u.handler.ListDeploys(context.Background(), site.ID, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(2, len(deploys)); diff != "" {
+		t.Errorf("Deploy count mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploader_Run_Rollback(t *testing.T) {
+	u, server := newTestUploader(t)
+	u.mode = modeRollback
+
+	site := server.AddSite(&models.Site{Name: "docs"})
+	first := server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+	second := server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main", Draft: true}, nil)
+	server.AddDeploy(site.ID, &models.Deploy{Branch: "main"}, nil)
+
+	// Each rollback goes one deploy further back from the published deploy, skipping drafts.
+	for _, expected := range []string{second.ID, first.ID} {
+		if err := u.run(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		published, err := u.handler.GetSiteByID(context.Background(), site.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(expected, published.PublishedDeploy.ID); diff != "" {
+			t.Errorf("Published deploy mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	if err := u.run(context.Background()); err == nil {
+		t.Error("Expected an error when there is no earlier deploy to roll back to")
+	}
+}